@@ -0,0 +1,73 @@
+package v1alpha1
+
+import (
+    corev1 "k8s.io/api/core/v1"
+)
+
+// Default fills in the defaults of the cluster's spec, so the stored object
+// shows what the operator runs. The mutating webhook applies it on
+// admission and the controller to the cluster it reads, which covers
+// clusters admitted without the webhook; it is idempotent.
+//
+// Replicas and the fileserver cache limits are left alone: they depend on
+// the sizingProfile, which may change later, and are resolved when read.
+func (c *HonseFarmCluster) Default() {
+    spec := &c.Spec
+    if spec.Namespace == "" {
+        spec.Namespace = DefaultNamespace
+    }
+
+    comps := spec.Components
+    if comps == nil {
+        return
+    }
+    if s := comps.Server; s != nil {
+        defaultPort(&s.Port, DefaultServerPort)
+        defaultPort(&s.MetricsPort, DefaultServerMetricsPort)
+        defaultStorage(s.Storage)
+    }
+    if a := comps.AdminPanel; a != nil {
+        defaultPort(&a.Port, DefaultAdminPanelPort)
+        defaultStorage(a.Storage)
+    }
+    if comps.Fileservers == nil {
+        return
+    }
+    if m := comps.Fileservers.Main; m != nil {
+        defaultPort(&m.Port, DefaultMainFileserverPort)
+        defaultPort(&m.MetricsPort, DefaultMainFileserverMetricsPort)
+        defaultStorage(m.Storage)
+        defaultVolume(m.Cache)
+        defaultVolume(m.ColdStorage)
+    }
+    for i := range comps.Fileservers.Shards {
+        shard := &comps.Fileservers.Shards[i]
+        defaultPort(&shard.Port, DefaultShardFileserverPort)
+        defaultPort(&shard.MetricsPort, DefaultShardFileserverMetricsPort)
+        defaultStorage(shard.Storage)
+        defaultVolume(shard.Cache)
+        defaultVolume(shard.ColdStorage)
+    }
+}
+
+func defaultPort(port *int32, def int32) {
+    if *port == 0 {
+        *port = def
+    }
+}
+
+// defaultStorage defaults the access modes of a PVC-backed storage.
+func defaultStorage(storage *StorageSpec) {
+    if storage == nil || storage.Size == "" || len(storage.AccessModes) > 0 {
+        return
+    }
+    storage.AccessModes = []string{string(corev1.ReadWriteOnce)}
+}
+
+func defaultVolume(volume *FileserverVolumeSpec) {
+    if volume == nil {
+        return
+    }
+    defaultStorage(volume.PVC)
+    defaultStorage(volume.Ephemeral)
+}
@@ -1,11 +1,37 @@
 package v1alpha1
 
 import (
+    corev1 "k8s.io/api/core/v1"
     metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
     "k8s.io/apimachinery/pkg/runtime"
+    "k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// Defaults filled into the spec by the mutating webhook and, for clusters
+// admitted without it, by the controller before reconciling. Replicas and
+// the cache limits depend on the sizingProfile and are never stored: they
+// apply when neither the component nor the profile sets a value.
+const (
+    DefaultNamespace = "honsefarm"
+
+    DefaultServerPort          int32 = 5000
+    DefaultAdminPanelPort      int32 = 5000
+    DefaultMainFileserverPort  int32 = 5001
+    DefaultShardFileserverPort int32 = 5002
+
+    DefaultServerMetricsPort          int32 = 4981
+    DefaultMainFileserverMetricsPort  int32 = 4982
+    DefaultShardFileserverMetricsPort int32 = 4983
+
+    DefaultReplicas int32 = 1
+
+    DefaultMainFileserverCacheSizeHardLimitInGiB  int64 = 10
+    DefaultShardFileserverCacheSizeHardLimitInGiB int64 = 100
 )
 
 type HonseFarmClusterSpec struct {
+    // Namespace the cluster's objects are created in.
+    // +kubebuilder:default=honsefarm
     Namespace    string            `json:"namespace"`
     APIDomain    string            `json:"apiDomain"`
     Hosts        *HostsSpec        `json:"hosts,omitempty"`
@@ -14,6 +40,17 @@ type HonseFarmClusterSpec struct {
     Components   *ComponentsSpec   `json:"components,omitempty"`
     Certificates *CertificatesSpec `json:"certificates,omitempty"`
     Cloudflared  *CloudflaredSpec  `json:"cloudflared,omitempty"`
+    // SizingProfile presets replicas, resources, cache sizes and
+    // DbContextPoolSize of every component. Values set on a component take
+    // precedence.
+    // +kubebuilder:validation:Enum=tiny;small;large
+    SizingProfile string `json:"sizingProfile,omitempty"`
+    // NamePrefix is prepended to the name of every object created for the
+    // cluster, so several clusters can share spec.namespace. It is fixed when
+    // the cluster is created; the webhook rejects changing it.
+    // +kubebuilder:validation:MaxLength=20
+    // +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+    NamePrefix string `json:"namePrefix,omitempty"`
 }
 
 type HostsSpec struct {
@@ -43,42 +80,60 @@ type GlobalLogging struct {
     AspNetCoreLevel string `json:"aspNetCoreLevel,omitempty"`
 }
 
+// SecretKeyRef selects a key of a Secret. Namespace defaults to
+// spec.namespace and may only be that or the cluster's own namespace.
+type SecretKeyRef struct {
+    Name      string `json:"name"`
+    Namespace string `json:"namespace,omitempty"`
+    Key       string `json:"key"`
+}
+
 type GlobalDatabase struct {
-    Host     string `json:"host,omitempty"`
-    Name     string `json:"name,omitempty"`
-    Username string `json:"username,omitempty"`
-    Password string `json:"password,omitempty"`
+    Host              string        `json:"host,omitempty"`
+    Name              string        `json:"name,omitempty"`
+    Username          string        `json:"username,omitempty"`
+    Password          string        `json:"password,omitempty"`
+    PasswordSecretRef *SecretKeyRef `json:"passwordSecretRef,omitempty"`
 }
 
 type GlobalRedis struct {
-    ConnectionString string `json:"connectionString,omitempty"`
-    Pool             int32  `json:"pool,omitempty"`
+    ConnectionString          string        `json:"connectionString,omitempty"`
+    ConnectionStringSecretRef *SecretKeyRef `json:"connectionStringSecretRef,omitempty"`
+    Pool                      int32         `json:"pool,omitempty"`
+    // UseGeneratedPassword adds the redisPassword generated into the
+    // honsefarm-secrets Secret to a connection string without a password,
+    // for a Redis set up with that password. The connection string is used
+    // as given otherwise.
+    UseGeneratedPassword bool `json:"useGeneratedPassword,omitempty"`
 }
 
 type GlobalJWT struct {
-    Secret string `json:"secret,omitempty"`
+    Secret    string        `json:"secret,omitempty"`
+    SecretRef *SecretKeyRef `json:"secretRef,omitempty"`
 }
 
 type GlobalTelemetry struct {
-    LogsEndpoint              string `json:"logsEndpoint,omitempty"`
-    AnalyticsOptIn            bool   `json:"analyticsOptIn,omitempty"`
-    AnalyticsConnectionString string `json:"analyticsConnectionString,omitempty"`
+    LogsEndpoint                       string        `json:"logsEndpoint,omitempty"`
+    AnalyticsOptIn                     bool          `json:"analyticsOptIn,omitempty"`
+    AnalyticsConnectionString          string        `json:"analyticsConnectionString,omitempty"`
+    AnalyticsConnectionStringSecretRef *SecretKeyRef `json:"analyticsConnectionStringSecretRef,omitempty"`
 }
 
 type GlobalFederation struct {
-    ServerID             string `json:"serverId,omitempty"`
-    ServerName           string `json:"serverName,omitempty"`
-    ServerDescription    string `json:"serverDescription,omitempty"`
-    ServerVersion        string `json:"serverVersion,omitempty"`
-    ServerLocation       string `json:"serverLocation,omitempty"`
-    ServerDiscordLink    string `json:"serverDiscordLink,omitempty"`
-    ServerType           string `json:"serverType,omitempty"`
-    ServerJoinSecret     string `json:"serverJoinSecret,omitempty"`
-    ServerBaseURL        string `json:"serverBaseUrl,omitempty"`
-    UseDNSBootstrap      bool   `json:"useDnsBootstrap,omitempty"`
-    DNSBootstrapHostname string `json:"dnsBootstrapHostname,omitempty"`
-    GroupUIDPrefix       string `json:"groupUidPrefix,omitempty"`
-    Role                 string `json:"role,omitempty"`
+    ServerID             string        `json:"serverId,omitempty"`
+    ServerName           string        `json:"serverName,omitempty"`
+    ServerDescription    string        `json:"serverDescription,omitempty"`
+    ServerVersion        string        `json:"serverVersion,omitempty"`
+    ServerLocation       string        `json:"serverLocation,omitempty"`
+    ServerDiscordLink    string        `json:"serverDiscordLink,omitempty"`
+    ServerType           string        `json:"serverType,omitempty"`
+    ServerJoinSecret     string        `json:"serverJoinSecret,omitempty"`
+    ServerJoinSecretRef  *SecretKeyRef `json:"serverJoinSecretRef,omitempty"`
+    ServerBaseURL        string        `json:"serverBaseUrl,omitempty"`
+    UseDNSBootstrap      bool          `json:"useDnsBootstrap,omitempty"`
+    DNSBootstrapHostname string        `json:"dnsBootstrapHostname,omitempty"`
+    GroupUIDPrefix       string        `json:"groupUidPrefix,omitempty"`
+    Role                 string        `json:"role,omitempty"`
 }
 
 type ImagesSpec struct {
@@ -95,22 +150,108 @@ type ComponentsSpec struct {
 }
 
 type StorageSpec struct {
-    Size             string   `json:"size,omitempty"`
-    StorageClassName string   `json:"storageClassName,omitempty"`
-    AccessModes      []string `json:"accessModes,omitempty"`
-}
+    Size             string `json:"size,omitempty"`
+    StorageClassName string `json:"storageClassName,omitempty"`
+    // AccessModes default to [ReadWriteOnce] once Size is set.
+    AccessModes []string `json:"accessModes,omitempty"`
+    // RetentionPolicy decides whether the PVC is deleted once its component
+    // or shard is removed from the spec. Defaults to Retain.
+    // +kubebuilder:validation:Enum=Retain;Delete
+    RetentionPolicy string `json:"retentionPolicy,omitempty"`
+    // DeletionPolicy decides what happens to the PVC when the
+    // HonseFarmCluster is deleted: Retain (default) keeps it for a recreated
+    // cluster to adopt, Delete removes it and Snapshot removes it once a
+    // VolumeSnapshot of it is ready.
+    // +kubebuilder:validation:Enum=Retain;Delete;Snapshot
+    DeletionPolicy string `json:"deletionPolicy,omitempty"`
+    // VolumeSnapshotClassName is used with DeletionPolicy Snapshot. Empty
+    // selects the default VolumeSnapshotClass.
+    VolumeSnapshotClassName string `json:"volumeSnapshotClassName,omitempty"`
+}
+
+// StorageSpec.RetentionPolicy values.
+const (
+    RetentionPolicyRetain = "Retain"
+    RetentionPolicyDelete = "Delete"
+)
+
+// StorageSpec.DeletionPolicy values.
+const (
+    DeletionPolicyRetain   = "Retain"
+    DeletionPolicyDelete   = "Delete"
+    DeletionPolicySnapshot = "Snapshot"
+)
 
 type ServerComponentSpec struct {
-    Replicas        *int32               `json:"replicas,omitempty"`
-    Storage         *StorageSpec         `json:"storage,omitempty"`
-    ConfigOverrides *runtime.RawExtension `json:"configOverrides,omitempty"`
+    // Replicas falls back to the sizingProfile preset, else 1.
+    Replicas *int32                  `json:"replicas,omitempty"`
+    Strategy *DeploymentStrategySpec `json:"strategy,omitempty"`
+    // Port the server listens on and its Service exposes.
+    // +kubebuilder:default=5000
+    // +kubebuilder:validation:Minimum=1
+    // +kubebuilder:validation:Maximum=65535
+    Port int32 `json:"port,omitempty"`
+    // MetricsPort serves the server's Prometheus metrics.
+    // +kubebuilder:default=4981
+    // +kubebuilder:validation:Minimum=1
+    // +kubebuilder:validation:Maximum=65535
+    MetricsPort int32 `json:"metricsPort,omitempty"`
+    // Resources of the component's container, overlaid per resource onto
+    // the sizingProfile preset.
+    Resources       *corev1.ResourceRequirements `json:"resources,omitempty"`
+    Storage         *StorageSpec                 `json:"storage,omitempty"`
+    ConfigOverrides *runtime.RawExtension        `json:"configOverrides,omitempty"`
+    SchedulingSpec  `json:",inline"`
 }
 
 type AdminPanelComponentSpec struct {
-    Replicas        *int32               `json:"replicas,omitempty"`
-    Storage         *StorageSpec         `json:"storage,omitempty"`
-    ConfigOverrides *runtime.RawExtension `json:"configOverrides,omitempty"`
-}
+    // Replicas falls back to the sizingProfile preset, else 1.
+    Replicas *int32                  `json:"replicas,omitempty"`
+    Strategy *DeploymentStrategySpec `json:"strategy,omitempty"`
+    // Port the admin panel listens on and its Service exposes.
+    // +kubebuilder:default=5000
+    // +kubebuilder:validation:Minimum=1
+    // +kubebuilder:validation:Maximum=65535
+    Port int32 `json:"port,omitempty"`
+    // Resources of the component's container, overlaid per resource onto
+    // the sizingProfile preset.
+    Resources       *corev1.ResourceRequirements `json:"resources,omitempty"`
+    Storage         *StorageSpec                 `json:"storage,omitempty"`
+    ConfigOverrides *runtime.RawExtension        `json:"configOverrides,omitempty"`
+    SchedulingSpec  `json:",inline"`
+}
+
+// SchedulingSpec places the pods of a component or shard.
+type SchedulingSpec struct {
+    NodeSelector map[string]string   `json:"nodeSelector,omitempty"`
+    Tolerations  []corev1.Toleration `json:"tolerations,omitempty"`
+    // Affinity replaces the default, a preferred anti-affinity that keeps
+    // replicas of the same workload on different nodes.
+    Affinity *corev1.Affinity `json:"affinity,omitempty"`
+    // TopologySpreadConstraints replace the default, a best-effort spread
+    // of the replicas across zones. Constraints without a labelSelector
+    // select the pods of the workload.
+    TopologySpreadConstraints []corev1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+    PriorityClassName         string                            `json:"priorityClassName,omitempty"`
+}
+
+// DeploymentStrategySpec selects how a component's Deployment replaces its
+// pods. Type defaults to Recreate when the component mounts a ReadWriteOnce
+// PVC, which a new pod cannot attach while the old one still holds it, and
+// to RollingUpdate otherwise. It is ignored with workloadKind StatefulSet.
+type DeploymentStrategySpec struct {
+    // +kubebuilder:validation:Enum=RollingUpdate;Recreate
+    Type string `json:"type,omitempty"`
+    // MaxSurge and MaxUnavailable tune RollingUpdate; they default to 25%.
+    MaxSurge       *intstr.IntOrString `json:"maxSurge,omitempty"`
+    MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+}
+
+// DeploymentStrategySpec.Type values.
+const (
+    StrategyRollingUpdate = "RollingUpdate"
+    StrategyRecreate      = "Recreate"
+)
 
 type FileserversSpec struct {
     Main   *MainFileserverSpec `json:"main,omitempty"`
@@ -118,17 +259,96 @@ type FileserversSpec struct {
 }
 
 type MainFileserverSpec struct {
-    Replicas        *int32               `json:"replicas,omitempty"`
-    Storage         *StorageSpec         `json:"storage,omitempty"`
-    ConfigOverrides *runtime.RawExtension `json:"configOverrides,omitempty"`
+    // WorkloadKind is Deployment (default) or StatefulSet.
+    // +kubebuilder:validation:Enum=Deployment;StatefulSet
+    WorkloadKind string `json:"workloadKind,omitempty"`
+    // Replicas falls back to the sizingProfile preset, else 1.
+    Replicas *int32                  `json:"replicas,omitempty"`
+    Strategy *DeploymentStrategySpec `json:"strategy,omitempty"`
+    // Port the main fileserver listens on and its Service exposes.
+    // +kubebuilder:default=5001
+    // +kubebuilder:validation:Minimum=1
+    // +kubebuilder:validation:Maximum=65535
+    Port int32 `json:"port,omitempty"`
+    // MetricsPort serves the main fileserver's Prometheus metrics.
+    // +kubebuilder:default=4982
+    // +kubebuilder:validation:Minimum=1
+    // +kubebuilder:validation:Maximum=65535
+    MetricsPort int32 `json:"metricsPort,omitempty"`
+    // Resources of the component's container, overlaid per resource onto
+    // the sizingProfile preset.
+    Resources   *corev1.ResourceRequirements `json:"resources,omitempty"`
+    Storage     *StorageSpec                 `json:"storage,omitempty"`
+    Cache       *FileserverVolumeSpec        `json:"cache,omitempty"`
+    ColdStorage *FileserverVolumeSpec        `json:"coldStorage,omitempty"`
+    // CacheSizeHardLimitInGiB caps the cache directory. Without it the
+    // sizingProfile preset applies, else 10, and a sized cache volume
+    // overrides it with the volume size minus headroom.
+    // +kubebuilder:validation:Minimum=1
+    CacheSizeHardLimitInGiB int64                 `json:"cacheSizeHardLimitInGiB,omitempty"`
+    ConfigOverrides         *runtime.RawExtension `json:"configOverrides,omitempty"`
+    SchedulingSpec          `json:",inline"`
 }
 
 type ShardSpec struct {
-    Name           string                `json:"name"`
-    ReplicaProfile string                `json:"replicaProfile,omitempty"`
-    Replicas       *int32               `json:"replicas,omitempty"`
-    Storage        *StorageSpec         `json:"storage,omitempty"`
-    ConfigOverrides *runtime.RawExtension `json:"configOverrides,omitempty"`
+    Name           string `json:"name"`
+    ReplicaProfile string `json:"replicaProfile,omitempty"`
+    // WorkloadKind is Deployment (default) or StatefulSet.
+    // +kubebuilder:validation:Enum=Deployment;StatefulSet
+    WorkloadKind string `json:"workloadKind,omitempty"`
+    // Replicas falls back to the sizingProfile preset, else 1.
+    Replicas *int32                  `json:"replicas,omitempty"`
+    Strategy *DeploymentStrategySpec `json:"strategy,omitempty"`
+    // Port the shard listens on and its Service exposes.
+    // +kubebuilder:default=5002
+    // +kubebuilder:validation:Minimum=1
+    // +kubebuilder:validation:Maximum=65535
+    Port int32 `json:"port,omitempty"`
+    // MetricsPort serves the shard's Prometheus metrics.
+    // +kubebuilder:default=4983
+    // +kubebuilder:validation:Minimum=1
+    // +kubebuilder:validation:Maximum=65535
+    MetricsPort int32 `json:"metricsPort,omitempty"`
+    // Resources of the component's container, overlaid per resource onto
+    // the sizingProfile preset.
+    Resources   *corev1.ResourceRequirements `json:"resources,omitempty"`
+    Storage     *StorageSpec                 `json:"storage,omitempty"`
+    Cache       *FileserverVolumeSpec        `json:"cache,omitempty"`
+    ColdStorage *FileserverVolumeSpec        `json:"coldStorage,omitempty"`
+    // CacheSizeHardLimitInGiB caps the cache directory. Without it the
+    // sizingProfile preset applies, else 100, and a sized cache volume
+    // overrides it with the volume size minus headroom.
+    // +kubebuilder:validation:Minimum=1
+    CacheSizeHardLimitInGiB int64                 `json:"cacheSizeHardLimitInGiB,omitempty"`
+    ConfigOverrides         *runtime.RawExtension `json:"configOverrides,omitempty"`
+    SchedulingSpec          `json:",inline"`
+}
+
+// WorkloadKind values. With StatefulSet every replica gets its own data,
+// cache and cold-storage PVCs through volumeClaimTemplates.
+const (
+    WorkloadKindDeployment  = "Deployment"
+    WorkloadKindStatefulSet = "StatefulSet"
+)
+
+// FileserverVolumeSpec backs a fileserver's cache or cold-storage directory.
+// Set exactly one of PVC, EmptyDir or Ephemeral. The generated size limit of
+// the directory is derived from the volume size.
+type FileserverVolumeSpec struct {
+    // PVC mounts a dedicated PersistentVolumeClaim.
+    PVC *StorageSpec `json:"pvc,omitempty"`
+    // EmptyDir mounts a node-local emptyDir.
+    EmptyDir *EmptyDirVolumeSpec `json:"emptyDir,omitempty"`
+    // Ephemeral mounts a generic ephemeral volume that lives as long as the
+    // pod. Only size, storageClassName and accessModes are used.
+    Ephemeral *StorageSpec `json:"ephemeral,omitempty"`
+}
+
+type EmptyDirVolumeSpec struct {
+    SizeLimit string `json:"sizeLimit,omitempty"`
+    // Medium is "" (node disk) or "Memory".
+    // +kubebuilder:validation:Enum="";Memory
+    Medium string `json:"medium,omitempty"`
 }
 
 type CertificatesSpec struct {
@@ -152,6 +372,8 @@ type CloudflaredSpec struct {
     Ingress              []CloudflaredIngressRule `json:"ingress,omitempty"`
 }
 
+// SecretRef names a Secret. Namespace defaults to spec.namespace and may
+// only be that or the cluster's own namespace.
 type SecretRef struct {
     Name      string `json:"name,omitempty"`
     Namespace string `json:"namespace,omitempty"`
@@ -167,9 +389,58 @@ type CloudflaredIngressRule struct {
     SpecialService   string `json:"specialService,omitempty"`
 }
 
+// Condition types reported in HonseFarmClusterStatus.Conditions.
+const (
+    ConditionReady               = "Ready"
+    ConditionProgressing         = "Progressing"
+    ConditionDegraded            = "Degraded"
+    ConditionConfigValid         = "ConfigValid"
+    ConditionCertificatesReady   = "CertificatesReady"
+    ConditionCredentialsResolved = "CredentialsResolved"
+    ConditionStorageValid        = "StorageValid"
+    ConditionReplicasValid       = "ReplicasValid"
+    ConditionNamespaceConflict   = "NamespaceConflict"
+)
+
 type HonseFarmClusterStatus struct {
-    Phase             string             `json:"phase,omitempty"`
-    CloudflaredStatus *CloudflaredStatus `json:"cloudflaredStatus,omitempty"`
+    Phase              string             `json:"phase,omitempty"`
+    ObservedGeneration int64              `json:"observedGeneration,omitempty"`
+    Conditions         []metav1.Condition `json:"conditions,omitempty"`
+    Components         []WorkloadStatus   `json:"components,omitempty"`
+    Shards             []WorkloadStatus   `json:"shards,omitempty"`
+    CloudflaredStatus  *CloudflaredStatus `json:"cloudflaredStatus,omitempty"`
+}
+
+// WorkloadStatus summarises the Deployment (and data PVC) backing a component
+// or shard.
+type WorkloadStatus struct {
+    Name      string `json:"name"`
+    Component string `json:"component"`
+    // Deployment is the name of the Deployment or, with workloadKind
+    // StatefulSet, the StatefulSet.
+    Deployment      string `json:"deployment"`
+    Kind            string `json:"kind,omitempty"`
+    DesiredReplicas int32  `json:"desiredReplicas"`
+    ReadyReplicas   int32  `json:"readyReplicas"`
+    UpdatedReplicas int32  `json:"updatedReplicas"`
+    Image           string `json:"image,omitempty"`
+    // ImageRolledOut is true once every replica runs Image.
+    ImageRolledOut bool       `json:"imageRolledOut"`
+    PVC            *PVCStatus `json:"pvc,omitempty"`
+}
+
+type PVCStatus struct {
+    Name     string `json:"name"`
+    Phase    string `json:"phase,omitempty"`
+    Bound    bool   `json:"bound"`
+    Capacity string `json:"capacity,omitempty"`
+    // Requested is the storage request of the PVC; it runs ahead of
+    // Capacity while an expansion is in progress.
+    Requested string `json:"requested,omitempty"`
+    // Resizing is the PVC condition of an ongoing expansion (Resizing or
+    // FileSystemResizePending), with its message in ResizeMessage.
+    Resizing      string `json:"resizing,omitempty"`
+    ResizeMessage string `json:"resizeMessage,omitempty"`
 }
 
 type CloudflaredStatus struct {
@@ -179,6 +450,9 @@ type CloudflaredStatus struct {
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 type HonseFarmCluster struct {
     metav1.TypeMeta   `json:",inline"`
     metav1.ObjectMeta `json:"metadata,omitempty"`
@@ -198,8 +472,289 @@ func (in *HonseFarmCluster) DeepCopyInto(out *HonseFarmCluster) {
     *out = *in
     out.TypeMeta = in.TypeMeta
     in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-    out.Spec = in.Spec
-    out.Status = in.Status
+    in.Spec.DeepCopyInto(&out.Spec)
+    in.Status.DeepCopyInto(&out.Status)
+}
+
+func (in *HonseFarmClusterSpec) DeepCopyInto(out *HonseFarmClusterSpec) {
+    *out = *in
+    if in.Hosts != nil {
+        out.Hosts = new(HostsSpec)
+        in.Hosts.DeepCopyInto(out.Hosts)
+    }
+    if in.Global != nil {
+        out.Global = new(GlobalConfig)
+        in.Global.DeepCopyInto(out.Global)
+    }
+    if in.Images != nil {
+        out.Images = new(ImagesSpec)
+        *out.Images = *in.Images
+    }
+    if in.Components != nil {
+        out.Components = new(ComponentsSpec)
+        in.Components.DeepCopyInto(out.Components)
+    }
+    if in.Certificates != nil {
+        out.Certificates = new(CertificatesSpec)
+        in.Certificates.DeepCopyInto(out.Certificates)
+    }
+    if in.Cloudflared != nil {
+        out.Cloudflared = new(CloudflaredSpec)
+        in.Cloudflared.DeepCopyInto(out.Cloudflared)
+    }
+}
+
+func (in *HostsSpec) DeepCopyInto(out *HostsSpec) {
+    *out = *in
+    if in.Shards != nil {
+        out.Shards = make([]HostShard, len(in.Shards))
+        copy(out.Shards, in.Shards)
+    }
+}
+
+func (in *GlobalConfig) DeepCopyInto(out *GlobalConfig) {
+    *out = *in
+    if in.Logging != nil {
+        out.Logging = new(GlobalLogging)
+        *out.Logging = *in.Logging
+    }
+    if in.Database != nil {
+        out.Database = new(GlobalDatabase)
+        *out.Database = *in.Database
+        out.Database.PasswordSecretRef = in.Database.PasswordSecretRef.DeepCopy()
+    }
+    if in.Redis != nil {
+        out.Redis = new(GlobalRedis)
+        *out.Redis = *in.Redis
+        out.Redis.ConnectionStringSecretRef = in.Redis.ConnectionStringSecretRef.DeepCopy()
+    }
+    if in.JWT != nil {
+        out.JWT = new(GlobalJWT)
+        *out.JWT = *in.JWT
+        out.JWT.SecretRef = in.JWT.SecretRef.DeepCopy()
+    }
+    if in.Telemetry != nil {
+        out.Telemetry = new(GlobalTelemetry)
+        *out.Telemetry = *in.Telemetry
+        out.Telemetry.AnalyticsConnectionStringSecretRef = in.Telemetry.AnalyticsConnectionStringSecretRef.DeepCopy()
+    }
+    if in.Federation != nil {
+        out.Federation = new(GlobalFederation)
+        *out.Federation = *in.Federation
+        out.Federation.ServerJoinSecretRef = in.Federation.ServerJoinSecretRef.DeepCopy()
+    }
+}
+
+func (in *SecretKeyRef) DeepCopy() *SecretKeyRef {
+    if in == nil {
+        return nil
+    }
+    out := new(SecretKeyRef)
+    *out = *in
+    return out
+}
+
+func (in *ComponentsSpec) DeepCopyInto(out *ComponentsSpec) {
+    *out = *in
+    if in.Server != nil {
+        out.Server = new(ServerComponentSpec)
+        in.Server.DeepCopyInto(out.Server)
+    }
+    if in.AdminPanel != nil {
+        out.AdminPanel = new(AdminPanelComponentSpec)
+        in.AdminPanel.DeepCopyInto(out.AdminPanel)
+    }
+    if in.Fileservers != nil {
+        out.Fileservers = new(FileserversSpec)
+        in.Fileservers.DeepCopyInto(out.Fileservers)
+    }
+}
+
+func (in *ServerComponentSpec) DeepCopyInto(out *ServerComponentSpec) {
+    *out = *in
+    out.Replicas = copyInt32(in.Replicas)
+    out.Strategy = in.Strategy.DeepCopy()
+    out.Resources = in.Resources.DeepCopy()
+    out.Storage = in.Storage.DeepCopy()
+    out.ConfigOverrides = in.ConfigOverrides.DeepCopy()
+    in.SchedulingSpec.DeepCopyInto(&out.SchedulingSpec)
+}
+
+func (in *AdminPanelComponentSpec) DeepCopyInto(out *AdminPanelComponentSpec) {
+    *out = *in
+    out.Replicas = copyInt32(in.Replicas)
+    out.Strategy = in.Strategy.DeepCopy()
+    out.Resources = in.Resources.DeepCopy()
+    out.Storage = in.Storage.DeepCopy()
+    out.ConfigOverrides = in.ConfigOverrides.DeepCopy()
+    in.SchedulingSpec.DeepCopyInto(&out.SchedulingSpec)
+}
+
+func (in *FileserversSpec) DeepCopyInto(out *FileserversSpec) {
+    *out = *in
+    if in.Main != nil {
+        out.Main = new(MainFileserverSpec)
+        in.Main.DeepCopyInto(out.Main)
+    }
+    if in.Shards != nil {
+        out.Shards = make([]ShardSpec, len(in.Shards))
+        for i := range in.Shards {
+            in.Shards[i].DeepCopyInto(&out.Shards[i])
+        }
+    }
+}
+
+func (in *MainFileserverSpec) DeepCopyInto(out *MainFileserverSpec) {
+    *out = *in
+    out.Replicas = copyInt32(in.Replicas)
+    out.Strategy = in.Strategy.DeepCopy()
+    out.Resources = in.Resources.DeepCopy()
+    out.Storage = in.Storage.DeepCopy()
+    out.Cache = in.Cache.DeepCopy()
+    out.ColdStorage = in.ColdStorage.DeepCopy()
+    out.ConfigOverrides = in.ConfigOverrides.DeepCopy()
+    in.SchedulingSpec.DeepCopyInto(&out.SchedulingSpec)
+}
+
+func (in *ShardSpec) DeepCopyInto(out *ShardSpec) {
+    *out = *in
+    out.Replicas = copyInt32(in.Replicas)
+    out.Strategy = in.Strategy.DeepCopy()
+    out.Resources = in.Resources.DeepCopy()
+    out.Storage = in.Storage.DeepCopy()
+    out.Cache = in.Cache.DeepCopy()
+    out.ColdStorage = in.ColdStorage.DeepCopy()
+    out.ConfigOverrides = in.ConfigOverrides.DeepCopy()
+    in.SchedulingSpec.DeepCopyInto(&out.SchedulingSpec)
+}
+
+func (in *SchedulingSpec) DeepCopyInto(out *SchedulingSpec) {
+    *out = *in
+    if in.NodeSelector != nil {
+        out.NodeSelector = make(map[string]string, len(in.NodeSelector))
+        for k, v := range in.NodeSelector {
+            out.NodeSelector[k] = v
+        }
+    }
+    if in.Tolerations != nil {
+        out.Tolerations = make([]corev1.Toleration, len(in.Tolerations))
+        for i := range in.Tolerations {
+            in.Tolerations[i].DeepCopyInto(&out.Tolerations[i])
+        }
+    }
+    out.Affinity = in.Affinity.DeepCopy()
+    if in.TopologySpreadConstraints != nil {
+        out.TopologySpreadConstraints = make([]corev1.TopologySpreadConstraint, len(in.TopologySpreadConstraints))
+        for i := range in.TopologySpreadConstraints {
+            in.TopologySpreadConstraints[i].DeepCopyInto(&out.TopologySpreadConstraints[i])
+        }
+    }
+}
+
+func (in *DeploymentStrategySpec) DeepCopy() *DeploymentStrategySpec {
+    if in == nil {
+        return nil
+    }
+    out := new(DeploymentStrategySpec)
+    *out = *in
+    if in.MaxSurge != nil {
+        out.MaxSurge = new(intstr.IntOrString)
+        *out.MaxSurge = *in.MaxSurge
+    }
+    if in.MaxUnavailable != nil {
+        out.MaxUnavailable = new(intstr.IntOrString)
+        *out.MaxUnavailable = *in.MaxUnavailable
+    }
+    return out
+}
+
+func (in *StorageSpec) DeepCopy() *StorageSpec {
+    if in == nil {
+        return nil
+    }
+    out := new(StorageSpec)
+    *out = *in
+    if in.AccessModes != nil {
+        out.AccessModes = make([]string, len(in.AccessModes))
+        copy(out.AccessModes, in.AccessModes)
+    }
+    return out
+}
+
+func (in *FileserverVolumeSpec) DeepCopy() *FileserverVolumeSpec {
+    if in == nil {
+        return nil
+    }
+    out := new(FileserverVolumeSpec)
+    out.PVC = in.PVC.DeepCopy()
+    if in.EmptyDir != nil {
+        out.EmptyDir = new(EmptyDirVolumeSpec)
+        *out.EmptyDir = *in.EmptyDir
+    }
+    out.Ephemeral = in.Ephemeral.DeepCopy()
+    return out
+}
+
+func (in *CertificatesSpec) DeepCopyInto(out *CertificatesSpec) {
+    *out = *in
+    if in.IssuerRef != nil {
+        out.IssuerRef = new(IssuerRef)
+        *out.IssuerRef = *in.IssuerRef
+    }
+    if in.DNSNames != nil {
+        out.DNSNames = make([]string, len(in.DNSNames))
+        copy(out.DNSNames, in.DNSNames)
+    }
+}
+
+func (in *CloudflaredSpec) DeepCopyInto(out *CloudflaredSpec) {
+    *out = *in
+    if in.CredentialsSecretRef != nil {
+        out.CredentialsSecretRef = new(SecretRef)
+        *out.CredentialsSecretRef = *in.CredentialsSecretRef
+    }
+    if in.ExtraArgs != nil {
+        out.ExtraArgs = make([]string, len(in.ExtraArgs))
+        copy(out.ExtraArgs, in.ExtraArgs)
+    }
+    if in.Ingress != nil {
+        out.Ingress = make([]CloudflaredIngressRule, len(in.Ingress))
+        copy(out.Ingress, in.Ingress)
+    }
+}
+
+func copyInt32(in *int32) *int32 {
+    if in == nil {
+        return nil
+    }
+    out := *in
+    return &out
+}
+
+func (in *HonseFarmClusterStatus) DeepCopyInto(out *HonseFarmClusterStatus) {
+    *out = *in
+    if in.Conditions != nil {
+        out.Conditions = make([]metav1.Condition, len(in.Conditions))
+        for i := range in.Conditions {
+            in.Conditions[i].DeepCopyInto(&out.Conditions[i])
+        }
+    }
+    if in.Components != nil {
+        out.Components = make([]WorkloadStatus, len(in.Components))
+        for i := range in.Components {
+            in.Components[i].DeepCopyInto(&out.Components[i])
+        }
+    }
+    if in.Shards != nil {
+        out.Shards = make([]WorkloadStatus, len(in.Shards))
+        for i := range in.Shards {
+            in.Shards[i].DeepCopyInto(&out.Shards[i])
+        }
+    }
+    if in.CloudflaredStatus != nil {
+        out.CloudflaredStatus = new(CloudflaredStatus)
+        *out.CloudflaredStatus = *in.CloudflaredStatus
+    }
 }
 
 func (in *HonseFarmCluster) DeepCopy() *HonseFarmCluster {
@@ -218,6 +773,14 @@ func (in *HonseFarmCluster) DeepCopyObject() runtime.Object {
     return nil
 }
 
+func (in *WorkloadStatus) DeepCopyInto(out *WorkloadStatus) {
+    *out = *in
+    if in.PVC != nil {
+        out.PVC = new(PVCStatus)
+        *out.PVC = *in.PVC
+    }
+}
+
 func (in *HonseFarmClusterList) DeepCopyInto(out *HonseFarmClusterList) {
     *out = *in
     out.TypeMeta = in.TypeMeta
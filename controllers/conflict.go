@@ -0,0 +1,128 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	v1alpha1 "honsefarm-operator/api/v1alpha1"
+	"honsefarm-operator/internal/naming"
+)
+
+// targetNamespaceIndex indexes HonseFarmClusters by the namespace their
+// objects are created in, spec.namespace or its default.
+const targetNamespaceIndex = "spec.namespace"
+
+// targetNamespaceIndexValues is the indexer function behind
+// targetNamespaceIndex.
+func targetNamespaceIndexValues(obj client.Object) []string {
+	cluster, ok := obj.(*v1alpha1.HonseFarmCluster)
+	if !ok {
+		return nil
+	}
+	return []string{naming.New(cluster).Namespace()}
+}
+
+// clustersInNamespace lists the HonseFarmClusters creating their objects in
+// ns.
+func (r *HonseFarmClusterReconciler) clustersInNamespace(ctx context.Context, ns string) ([]v1alpha1.HonseFarmCluster, error) {
+	var clusters v1alpha1.HonseFarmClusterList
+	if err := r.List(ctx, &clusters, client.MatchingFields{targetNamespaceIndex: ns}); err != nil {
+		return nil, err
+	}
+	return clusters.Items, nil
+}
+
+// namespaceConflict returns the HonseFarmCluster whose objects would collide
+// with those of cluster: one with the same target namespace that came first
+// and either has the same spec.namePrefix or where one of the two has none.
+// The oldest cluster keeps the namespace and every later one is held back,
+// so neither overwrites the other.
+func (r *HonseFarmClusterReconciler) namespaceConflict(
+	ctx context.Context,
+	cluster *v1alpha1.HonseFarmCluster,
+) (*v1alpha1.HonseFarmCluster, error) {
+	names := naming.New(cluster)
+	clusters, err := r.clustersInNamespace(ctx, names.Namespace())
+	if err != nil {
+		return nil, err
+	}
+
+	var first *v1alpha1.HonseFarmCluster
+	for i := range clusters {
+		other := &clusters[i]
+		if other.UID == cluster.UID || !prefixesCollide(names.Prefix(), naming.New(other).Prefix()) {
+			continue
+		}
+		if !createdBefore(other, cluster) {
+			continue
+		}
+		if first == nil || createdBefore(other, first) {
+			first = other
+		}
+	}
+	return first, nil
+}
+
+// prefixesCollide reports whether two clusters with the name prefixes a and
+// b cannot share a namespace. Equal prefixes give equal object names. An
+// empty prefix collides with every other one: the workload selectors of an
+// unprefixed cluster carry no naming.InstanceLabel, and since selectors are
+// immutable they would also match the pods of a prefixed cluster.
+func prefixesCollide(a, b string) bool {
+	return a == b || a == "" || b == ""
+}
+
+// createdBefore orders clusters by creation time, then by namespace and
+// name, so every reconcile agrees on which of two clusters came first.
+func createdBefore(a, b *v1alpha1.HonseFarmCluster) bool {
+	if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+		return a.CreationTimestamp.Before(&b.CreationTimestamp)
+	}
+	if a.Namespace != b.Namespace {
+		return a.Namespace < b.Namespace
+	}
+	return a.Name < b.Name
+}
+
+// namespaceConflictMessage describes the conflict of cluster with other.
+func namespaceConflictMessage(cluster, other *v1alpha1.HonseFarmCluster) string {
+	names, otherNames := naming.New(cluster), naming.New(other)
+	if names.Prefix() != otherNames.Prefix() {
+		return fmt.Sprintf("namespace %s is already used by HonseFarmCluster %s/%s; clusters sharing a namespace "+
+			"must all set spec.namePrefix, recreate it with a prefix or a different spec.namespace", names.Namespace(), other.Namespace, other.Name)
+	}
+	return fmt.Sprintf("namespace %s with namePrefix %q is already used by HonseFarmCluster %s/%s; "+
+		"recreate it with a different spec.namespace or spec.namePrefix", names.Namespace(), names.Prefix(), other.Namespace, other.Name)
+}
+
+// clustersSharingNamespace maps a HonseFarmCluster event to the other
+// clusters with the same target namespace, so a cluster held back by a
+// NamespaceConflict takes over once the conflicting cluster is gone.
+func (r *HonseFarmClusterReconciler) clustersSharingNamespace(ctx context.Context, obj client.Object) []reconcile.Request {
+	cluster, ok := obj.(*v1alpha1.HonseFarmCluster)
+	if !ok {
+		return nil
+	}
+	clusters, err := r.clustersInNamespace(ctx, naming.New(cluster).Namespace())
+	if err != nil {
+		log.FromContext(ctx).Error(err, "failed to list HonseFarmClusters sharing namespace",
+			"namespace", naming.New(cluster).Namespace())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, other := range clusters {
+		if other.UID == cluster.UID {
+			continue
+		}
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: other.Name, Namespace: other.Namespace},
+		})
+	}
+	return requests
+}
@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	v1alpha1 "honsefarm-operator/api/v1alpha1"
+)
+
+func testCluster(name, prefix string, created time.Time) *v1alpha1.HonseFarmCluster {
+	return &v1alpha1.HonseFarmCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         "default",
+			UID:               types.UID(name),
+			CreationTimestamp: metav1.NewTime(created),
+		},
+		Spec: v1alpha1.HonseFarmClusterSpec{
+			Namespace:  "honsefarm",
+			NamePrefix: prefix,
+		},
+	}
+}
+
+func TestNamespaceConflict(t *testing.T) {
+	older := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := older.Add(time.Hour)
+
+	tests := []struct {
+		name     string
+		clusters []*v1alpha1.HonseFarmCluster
+		// conflicts maps every cluster to the one holding it back, empty
+		// when it is reconciled.
+		conflicts map[string]string
+	}{
+		{
+			name: "unprefixed cluster first",
+			clusters: []*v1alpha1.HonseFarmCluster{
+				testCluster("prod", "", older),
+				testCluster("staging", "staging", newer),
+			},
+			conflicts: map[string]string{"prod": "", "staging": "prod"},
+		},
+		{
+			name: "prefixed cluster first",
+			clusters: []*v1alpha1.HonseFarmCluster{
+				testCluster("staging", "staging", older),
+				testCluster("prod", "", newer),
+			},
+			conflicts: map[string]string{"staging": "", "prod": "staging"},
+		},
+		{
+			name: "different prefixes",
+			clusters: []*v1alpha1.HonseFarmCluster{
+				testCluster("prod", "prod", older),
+				testCluster("staging", "staging", newer),
+			},
+			conflicts: map[string]string{"prod": "", "staging": ""},
+		},
+		{
+			name: "same prefix",
+			clusters: []*v1alpha1.HonseFarmCluster{
+				testCluster("a", "staging", older),
+				testCluster("b", "staging", newer),
+			},
+			conflicts: map[string]string{"a": "", "b": "a"},
+		},
+	}
+
+	scheme := runtime.NewScheme()
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithIndex(&v1alpha1.HonseFarmCluster{}, targetNamespaceIndex, targetNamespaceIndexValues)
+			for _, cluster := range tt.clusters {
+				builder = builder.WithObjects(cluster)
+			}
+			r := &HonseFarmClusterReconciler{Client: builder.Build()}
+
+			for _, cluster := range tt.clusters {
+				other, err := r.namespaceConflict(context.Background(), cluster)
+				if err != nil {
+					t.Fatalf("%s: %v", cluster.Name, err)
+				}
+				got := ""
+				if other != nil {
+					got = other.Name
+				}
+				if want := tt.conflicts[cluster.Name]; got != want {
+					t.Errorf("%s: conflict with %q, want %q", cluster.Name, got, want)
+				}
+			}
+		})
+	}
+}
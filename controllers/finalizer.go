@@ -0,0 +1,303 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	v1alpha1 "honsefarm-operator/api/v1alpha1"
+	coreinternal "honsefarm-operator/internal/core"
+	"honsefarm-operator/internal/naming"
+)
+
+// clusterFinalizer holds a deleted HonseFarmCluster until its data PVCs have
+// been handled according to their DeletionPolicy and its other children have
+// been deleted. Children live in spec.namespace, usually not the cluster's
+// own, so owner references cannot garbage-collect them.
+const clusterFinalizer = "honsefarm.io/cleanup"
+
+var volumeSnapshotGVK = schema.GroupVersionKind{
+	Group:   "snapshot.storage.k8s.io",
+	Version: "v1",
+	Kind:    "VolumeSnapshot",
+}
+
+// finalizeCluster runs when the cluster is being deleted. It removes the
+// finalizer once every data PVC has been retained, deleted or snapshotted
+// and deleted, and the workloads, Services, ConfigMaps, Secrets and
+// Certificate of the cluster are gone. stored is cluster as read, before
+// its spec was defaulted.
+func (r *HonseFarmClusterReconciler) finalizeCluster(
+	ctx context.Context,
+	stored, cluster *v1alpha1.HonseFarmCluster,
+) (ctrl.Result, error) {
+	if !controllerutil.ContainsFinalizer(cluster, clusterFinalizer) {
+		return ctrl.Result{}, nil
+	}
+
+	pending, err := r.releaseStorage(ctx, cluster)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if pending {
+		// Waiting for VolumeSnapshots to become ready.
+		return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+	}
+	if err := r.deleteChildren(ctx, cluster); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	controllerutil.RemoveFinalizer(cluster, clusterFinalizer)
+	return ctrl.Result{}, r.patchFinalizers(ctx, stored, cluster)
+}
+
+// patchFinalizers writes the finalizers of cluster with a merge patch
+// against stored, the cluster as read. Updating cluster itself would persist
+// its in-memory spec defaults.
+func (r *HonseFarmClusterReconciler) patchFinalizers(ctx context.Context, stored, cluster *v1alpha1.HonseFarmCluster) error {
+	patch := client.MergeFromWithOptions(stored.DeepCopy(), client.MergeFromWithOptimisticLock{})
+	stored.Finalizers = cluster.Finalizers
+	if err := r.Patch(ctx, stored, patch); err != nil {
+		return err
+	}
+	cluster.ResourceVersion = stored.ResourceVersion
+	return nil
+}
+
+// releaseStorage applies the deletion policy of every data PVC of cluster.
+// It reports whether some PVC is still waiting for its snapshot.
+func (r *HonseFarmClusterReconciler) releaseStorage(ctx context.Context, cluster *v1alpha1.HonseFarmCluster) (bool, error) {
+	logger := log.FromContext(ctx)
+	names := naming.New(cluster)
+
+	snapshotClasses := map[string]string{}
+	for _, w := range coreinternal.Workloads(cluster) {
+		if w.Storage != nil {
+			snapshotClasses[w.PVCName] = w.Storage.VolumeSnapshotClassName
+		}
+		for _, extra := range w.AdditionalPVCs {
+			snapshotClasses[extra.Name] = extra.Storage.VolumeSnapshotClassName
+		}
+	}
+
+	var pvcList corev1.PersistentVolumeClaimList
+	if err := r.List(ctx, &pvcList,
+		client.InNamespace(names.Namespace()),
+		client.MatchingLabels(names.ClusterLabels()),
+		client.HasLabels{"honsefarm-component"},
+	); err != nil {
+		return false, err
+	}
+
+	pending := false
+	for i := range pvcList.Items {
+		pvc := &pvcList.Items[i]
+		if pvc.DeletionTimestamp != nil {
+			continue
+		}
+
+		switch pvc.Annotations[coreinternal.DeletionPolicyAnnotation] {
+		case v1alpha1.DeletionPolicyDelete:
+		case v1alpha1.DeletionPolicySnapshot:
+			ready, err := r.ensureFinalSnapshot(ctx, cluster, pvc, snapshotClasses[pvc.Name])
+			if meta.IsNoMatchError(err) {
+				r.Recorder.Eventf(cluster, corev1.EventTypeWarning, "SnapshotUnsupported",
+					"VolumeSnapshots are not available, retaining PVC %s/%s", pvc.Namespace, pvc.Name)
+				continue
+			}
+			if err != nil {
+				return false, err
+			}
+			if !ready {
+				pending = true
+				continue
+			}
+		default:
+			logger.Info("retaining PVC of deleted cluster", "namespace", pvc.Namespace, "name", pvc.Name)
+			continue
+		}
+
+		if err := r.Delete(ctx, pvc); client.IgnoreNotFound(err) != nil {
+			return false, err
+		}
+		logger.Info("deleted PVC of deleted cluster", "namespace", pvc.Namespace, "name", pvc.Name)
+	}
+
+	return pending, nil
+}
+
+// deleteChildren deletes every object labelled as belonging to cluster except
+// its PVCs, which releaseStorage handles, and VolumeSnapshots, which are
+// meant to outlive it. The core Secret is kept while a retained data PVC of
+// the cluster is left, since the data may depend on its credentials. A
+// namespace the operator created for the cluster is deleted once no PVC at
+// all is left in it and no other cluster uses it.
+func (r *HonseFarmClusterReconciler) deleteChildren(ctx context.Context, cluster *v1alpha1.HonseFarmCluster) error {
+	logger := log.FromContext(ctx)
+	names := naming.New(cluster)
+	ns := names.Namespace()
+
+	var pvcList corev1.PersistentVolumeClaimList
+	if err := r.List(ctx, &pvcList,
+		client.InNamespace(ns),
+		client.MatchingLabels(names.ClusterLabels()),
+		client.HasLabels{"honsefarm-component"},
+	); err != nil {
+		return err
+	}
+	retained := false
+	for i := range pvcList.Items {
+		if pvcList.Items[i].DeletionTimestamp == nil {
+			retained = true
+		}
+	}
+
+	lists := []client.ObjectList{
+		&appsv1.DeploymentList{},
+		&appsv1.StatefulSetList{},
+		&corev1.ServiceList{},
+		&corev1.ConfigMapList{},
+		&corev1.SecretList{},
+	}
+	for _, list := range lists {
+		if err := r.List(ctx, list, client.InNamespace(ns), client.MatchingLabels(names.ClusterLabels())); err != nil {
+			return err
+		}
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			obj := item.(client.Object)
+			if _, ok := obj.(*corev1.Secret); ok && obj.GetName() == names.Name(coreinternal.CoreSecretName) && retained {
+				continue
+			}
+			if err := r.Delete(ctx, obj); client.IgnoreNotFound(err) != nil {
+				return err
+			}
+			logger.V(1).Info("deleted child of deleted cluster", "kind", fmt.Sprintf("%T", obj),
+				"namespace", obj.GetNamespace(), "name", obj.GetName())
+		}
+	}
+
+	// The Certificate is matched by label too: a cluster held back by a
+	// NamespaceConflict must not delete the one of the cluster it yields to.
+	certList := &unstructured.UnstructuredList{}
+	certList.SetGroupVersionKind(schema.GroupVersionKind{
+		Group:   "cert-manager.io",
+		Version: "v1",
+		Kind:    "CertificateList",
+	})
+	err := r.List(ctx, certList, client.InNamespace(ns), client.MatchingLabels(names.ClusterLabels()))
+	if err != nil && !meta.IsNoMatchError(err) {
+		return err
+	}
+	for i := range certList.Items {
+		if err := r.Delete(ctx, &certList.Items[i]); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+
+	if retained {
+		return nil
+	}
+	// Deleting the namespace would take PVCs of others with it.
+	var nsPVCs corev1.PersistentVolumeClaimList
+	if err := r.List(ctx, &nsPVCs, client.InNamespace(ns)); err != nil {
+		return err
+	}
+	for i := range nsPVCs.Items {
+		if nsPVCs.Items[i].DeletionTimestamp == nil {
+			return nil
+		}
+	}
+	// Other clusters may still run in the namespace.
+	others, err := r.clustersInNamespace(ctx, ns)
+	if err != nil {
+		return err
+	}
+	for _, other := range others {
+		if other.UID != cluster.UID {
+			return nil
+		}
+	}
+	var namespace corev1.Namespace
+	if err := r.Get(ctx, types.NamespacedName{Name: ns}, &namespace); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	for k, v := range names.ClusterLabels() {
+		if namespace.Labels[k] != v {
+			// Not created by the operator for this cluster.
+			return nil
+		}
+	}
+	if namespace.DeletionTimestamp != nil {
+		return nil
+	}
+	if err := r.Delete(ctx, &namespace); client.IgnoreNotFound(err) != nil {
+		return err
+	}
+	logger.Info("deleted namespace of deleted cluster", "namespace", ns)
+	return nil
+}
+
+// ensureFinalSnapshot creates a VolumeSnapshot of pvc taken at cluster
+// deletion and reports whether it is ready to use. The snapshot has no owner
+// so it outlives the cluster.
+func (r *HonseFarmClusterReconciler) ensureFinalSnapshot(
+	ctx context.Context,
+	cluster *v1alpha1.HonseFarmCluster,
+	pvc *corev1.PersistentVolumeClaim,
+	className string,
+) (bool, error) {
+	name := fmt.Sprintf("%s-%d", pvc.Name, cluster.DeletionTimestamp.Unix())
+
+	snap := &unstructured.Unstructured{}
+	snap.SetGroupVersionKind(volumeSnapshotGVK)
+	err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: pvc.Namespace}, snap)
+	if errors.IsNotFound(err) {
+		snap.SetName(name)
+		snap.SetNamespace(pvc.Namespace)
+		snap.SetLabels(naming.New(cluster).WithClusterLabels(map[string]string{
+			"app.kubernetes.io/managed-by": "honsefarm-operator",
+			"honsefarm-pvc":                pvc.Name,
+		}))
+		spec := map[string]interface{}{
+			"source": map[string]interface{}{
+				"persistentVolumeClaimName": pvc.Name,
+			},
+		}
+		if className != "" {
+			spec["volumeSnapshotClassName"] = className
+		}
+		snap.Object["spec"] = spec
+		if err := r.Create(ctx, snap); err != nil {
+			return false, err
+		}
+		r.Recorder.Eventf(cluster, corev1.EventTypeNormal, "SnapshotCreated",
+			"created VolumeSnapshot %s/%s of PVC %s", pvc.Namespace, name, pvc.Name)
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if message, found, _ := unstructured.NestedString(snap.Object, "status", "error", "message"); found && message != "" {
+		r.Recorder.Eventf(cluster, corev1.EventTypeWarning, "SnapshotFailed",
+			"VolumeSnapshot %s/%s: %s", pvc.Namespace, name, message)
+	}
+	ready, _, _ := unstructured.NestedBool(snap.Object, "status", "readyToUse")
+	return ready, nil
+}
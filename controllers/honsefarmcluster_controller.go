@@ -2,7 +2,8 @@ package controllers
 
 import (
 	"context"
-	"fmt"
+	stderrors "errors"
+	"strings"
 	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
@@ -14,19 +15,34 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	v1alpha1 "honsefarm-operator/api/v1alpha1"
+	"honsefarm-operator/internal/cloudflared"
 	cfginternal "honsefarm-operator/internal/config"
 	coreinternal "honsefarm-operator/internal/core"
+	"honsefarm-operator/internal/naming"
+)
+
+const (
+	certificatesModeSelfSigned = "selfSigned"
+
+	// Names of the certificate Secrets and Certificate, before the
+	// spec.namePrefix.
+	tlsSecretName = "honsefarm-tls"
+	caSecretName  = "honsefarm-ca"
 )
 
 // HonseFarmClusterReconciler reconciles a HonseFarmCluster object
 type HonseFarmClusterReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
 }
 
 //+kubebuilder:rbac:groups=clusters.honse.farm,resources=honsefarmclusters,verbs=get;list;watch;create;update;patch;delete
@@ -37,8 +53,15 @@ type HonseFarmClusterReconciler struct {
 //+kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups="",resources=secrets;configmaps;services;persistentvolumeclaims,verbs=get;list;watch;create;update;patch;delete
 
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups="",resources=pods,verbs=list
+
 // workloads
-//+kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=apps,resources=deployments;statefulsets,verbs=get;list;watch;create;update;patch;delete
+
+// storage
+//+kubebuilder:rbac:groups=snapshot.storage.k8s.io,resources=volumesnapshots,verbs=get;list;watch;create
+//+kubebuilder:rbac:groups=storage.k8s.io,resources=storageclasses,verbs=get;list;watch
 
 func (r *HonseFarmClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	logger := log.FromContext(ctx)
@@ -50,12 +73,59 @@ func (r *HonseFarmClusterReconciler) Reconcile(ctx context.Context, req ctrl.Req
 		}
 		return ctrl.Result{}, err
 	}
+	// Clusters admitted without the mutating webhook, or before it existed,
+	// get the same defaults in memory, so everything below reads one
+	// defaulted spec. They are never written back: stored is the cluster as
+	// read, which finalizer changes are patched against.
+	stored := cluster.DeepCopy()
+	cluster.Default()
+
+	if !cluster.DeletionTimestamp.IsZero() {
+		return r.finalizeCluster(ctx, stored, &cluster)
+	}
+	if controllerutil.AddFinalizer(&cluster, clusterFinalizer) {
+		if err := r.patchFinalizers(ctx, stored, &cluster); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// A second cluster using the same namespace and name prefix would
+	// overwrite the objects of the first; hold it back instead.
+	other, err := r.namespaceConflict(ctx, &cluster)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if other != nil {
+		message := namespaceConflictMessage(&cluster, other)
+		r.Recorder.Event(&cluster, corev1.EventTypeWarning, "NamespaceConflict", message)
+		logger.Info("namespace conflict, not reconciling", "cluster", other.Namespace+"/"+other.Name)
+		setCondition(&cluster, v1alpha1.ConditionNamespaceConflict, metav1.ConditionTrue, "NameCollision", message)
+		setCondition(&cluster, v1alpha1.ConditionReady, metav1.ConditionFalse, "NamespaceConflict", message)
+		cluster.Status.Phase = phaseDegraded
+		cluster.Status.ObservedGeneration = cluster.Generation
+		return ctrl.Result{}, r.Status().Update(ctx, &cluster)
+	}
+	setCondition(&cluster, v1alpha1.ConditionNamespaceConflict, metav1.ConditionFalse, "NoConflict",
+		"no other cluster uses this namespace and namePrefix")
+
+	result, err := r.reconcileCluster(ctx, &cluster)
+	if statusErr := r.updateStatus(ctx, &cluster, err); statusErr != nil {
+		logger.Error(statusErr, "failed to update status")
+		if err == nil {
+			return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+		}
+	}
+	return result, err
+}
+
+// reconcileCluster applies every object the cluster spec asks for. Status
+// conditions describing individual steps are recorded on cluster as it goes;
+// the caller persists them.
+func (r *HonseFarmClusterReconciler) reconcileCluster(ctx context.Context, cluster *v1alpha1.HonseFarmCluster) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
 
 	// Ensure target namespace exists
 	targetNS := cluster.Spec.Namespace
-	if targetNS == "" {
-		targetNS = "honsefarm"
-	}
 
 	var ns corev1.Namespace
 	if err := r.Get(ctx, types.NamespacedName{Name: targetNS}, &ns); err != nil {
@@ -63,9 +133,11 @@ func (r *HonseFarmClusterReconciler) Reconcile(ctx context.Context, req ctrl.Req
 			ns = corev1.Namespace{
 				ObjectMeta: metav1.ObjectMeta{
 					Name: targetNS,
-					Labels: map[string]string{
+					// The cluster labels mark the namespace as created
+					// for this cluster; the finalizer deletes it again.
+					Labels: naming.New(cluster).WithClusterLabels(map[string]string{
 						"app.kubernetes.io/managed-by": "honsefarm-operator",
-					},
+					}),
 				},
 			}
 			if err := r.Create(ctx, &ns); err != nil {
@@ -78,99 +150,195 @@ func (r *HonseFarmClusterReconciler) Reconcile(ctx context.Context, req ctrl.Req
 		}
 	}
 
-	// Ensure core secret exists
-	if err := coreinternal.EnsureCoreSecret(ctx, r.Client, &cluster); err != nil {
+	// Ensure core secret exists; its generated values back any credential
+	// left empty in spec.global.
+	creds, err := coreinternal.EnsureCoreSecret(ctx, r.Client, cluster)
+	if err != nil {
 		logger.Error(err, "failed to ensure core secret")
 		return ctrl.Result{}, err
 	}
 
-	// Ensure config ConfigMap exists / is updated
-	cm, err := cfginternal.BuildConfigMap(&cluster)
+	// Resolve spec.global secret references; without them the configuration
+	// cannot be rendered, so stop here until the referenced Secret appears.
+	resolved, err := r.resolveSecretRefs(ctx, cluster)
+	if err != nil {
+		var refErr *secretRefError
+		if !stderrors.As(err, &refErr) {
+			logger.Error(err, "failed to resolve secret references")
+			return ctrl.Result{}, err
+		}
+		logger.Info("secret reference cannot be resolved", "reason", refErr.Reason(), "error", refErr.Error())
+		setCondition(cluster, v1alpha1.ConditionCredentialsResolved, metav1.ConditionFalse, refErr.Reason(), refErr.Error())
+		setCondition(cluster, v1alpha1.ConditionConfigValid, metav1.ConditionFalse, "CredentialsUnresolved", refErr.Error())
+		return ctrl.Result{}, nil
+	}
+	setCondition(cluster, v1alpha1.ConditionCredentialsResolved, metav1.ConditionTrue, "Resolved", "all secret references resolved")
+	creds.Resolved = resolved
+
+	// Ensure config ConfigMap + Secret exist / are updated
+	bundle, err := cfginternal.Build(cluster, creds)
 	if err != nil {
-		logger.Error(err, "failed to build config ConfigMap")
+		logger.Error(err, "failed to build config")
+		setCondition(cluster, v1alpha1.ConditionConfigValid, metav1.ConditionFalse, "BuildFailed", err.Error())
+		return ctrl.Result{}, err
+	}
+	if len(bundle.OverrideErrors) > 0 {
+		// Rolling out configuration without the override the user asked for
+		// could be worse than keeping the current one, so stop here.
+		msgs := make([]string, 0, len(bundle.OverrideErrors))
+		for _, oe := range bundle.OverrideErrors {
+			msgs = append(msgs, oe.Error())
+			r.Recorder.Event(cluster, corev1.EventTypeWarning, "InvalidConfigOverride", oe.Error())
+		}
+		logger.Info("invalid configOverrides, not applying configuration", "errors", msgs)
+		setCondition(cluster, v1alpha1.ConditionConfigValid, metav1.ConditionFalse, "InvalidOverride", strings.Join(msgs, "; "))
+		return ctrl.Result{}, nil
+	}
+	setCondition(cluster, v1alpha1.ConditionConfigValid, metav1.ConditionTrue, "Rendered", "configuration rendered")
+	if err := r.ensureConfigMap(ctx, cluster, bundle.ConfigMap); err != nil {
+		logger.Error(err, "failed to ensure config ConfigMap")
 		return ctrl.Result{}, err
 	}
-	if err := ctrl.SetControllerReference(&cluster, cm, r.Scheme); err != nil {
-		logger.Error(err, "failed to set owner reference on config ConfigMap")
+	if err := r.ensureSecret(ctx, cluster, bundle.Secret); err != nil {
+		logger.Error(err, "failed to ensure config Secret")
 		return ctrl.Result{}, err
 	}
 
-	var existingCM corev1.ConfigMap
-	err = r.Get(ctx, types.NamespacedName{Name: cm.Name, Namespace: cm.Namespace}, &existingCM)
-	if err != nil {
-		if errors.IsNotFound(err) {
-			if err := r.Create(ctx, cm); err != nil {
-				logger.Error(err, "failed to create config ConfigMap")
-				return ctrl.Result{}, err
-			}
-			logger.Info("created honsefarm config ConfigMap", "namespace", cm.Namespace, "name", cm.Name)
-		} else {
-			return ctrl.Result{}, err
-		}
-	} else {
-		existingCM.Data = cm.Data
-		if err := r.Update(ctx, &existingCM); err != nil {
-			logger.Error(err, "failed to update config ConfigMap")
-			return ctrl.Result{}, err
+	// A second pod of a Deployment on a ReadWriteOnce PVC could never start;
+	// refuse such a spec instead of rolling out a workload that hangs.
+	if conflicts := coreinternal.ReplicaConflicts(cluster); len(conflicts) > 0 {
+		for _, conflict := range conflicts {
+			r.Recorder.Event(cluster, corev1.EventTypeWarning, "ReadWriteOnceReplicas", conflict)
 		}
+		logger.Info("replicas conflict with ReadWriteOnce volumes, not applying workloads", "errors", conflicts)
+		setCondition(cluster, v1alpha1.ConditionReplicasValid, metav1.ConditionFalse, "ReadWriteOnceReplicas",
+			strings.Join(conflicts, "; "))
+		return ctrl.Result{}, nil
 	}
+	setCondition(cluster, v1alpha1.ConditionReplicasValid, metav1.ConditionTrue, "Valid", "replica counts fit the volume access modes")
 
 	// Ensure core workloads (PVCs + Deployments)
-	if err := coreinternal.EnsureServerWorkload(ctx, r.Client, r.Scheme, &cluster); err != nil {
+	if err := coreinternal.EnsureServerWorkload(ctx, r.Client, cluster, bundle); err != nil {
 		logger.Error(err, "failed to ensure server workload")
 		return ctrl.Result{}, err
 	}
-	if err := coreinternal.EnsureAdminWorkload(ctx, r.Client, r.Scheme, &cluster); err != nil {
+	if err := coreinternal.EnsureAdminWorkload(ctx, r.Client, cluster, bundle); err != nil {
 		logger.Error(err, "failed to ensure admin workload")
 		return ctrl.Result{}, err
 	}
-	if err := coreinternal.EnsureMainFileserverWorkload(ctx, r.Client, r.Scheme, &cluster); err != nil {
+	// A fileserver switching to a StatefulSet waits for the pods of its
+	// Deployment before cloning their PVCs; carry on with the rest and
+	// check again shortly.
+	waiting := false
+	if err := coreinternal.EnsureMainFileserverWorkload(ctx, r.Client, cluster, bundle); stderrors.Is(err, coreinternal.ErrLegacyPodsRunning) {
+		logger.Info("waiting to switch main fileserver to a StatefulSet", "reason", err.Error())
+		waiting = true
+	} else if err != nil {
 		logger.Error(err, "failed to ensure main fileserver workload")
 		return ctrl.Result{}, err
 	}
-	if err := coreinternal.EnsureShardWorkloads(ctx, r.Client, r.Scheme, &cluster); err != nil {
+	if err := coreinternal.EnsureShardWorkloads(ctx, r.Client, cluster, bundle); stderrors.Is(err, coreinternal.ErrLegacyPodsRunning) {
+		logger.Info("waiting to switch shard fileserver to a StatefulSet", "reason", err.Error())
+		waiting = true
+	} else if err != nil {
 		logger.Error(err, "failed to ensure shard workloads")
 		return ctrl.Result{}, err
 	}
 
 	// Ensure Services for core components and shards
-	if err := r.ensureCoreServices(ctx, &cluster); err != nil {
-		logger.Error(err, "failed to ensure core services")
+	if err := r.ensureServices(ctx, cluster); err != nil {
+		logger.Error(err, "failed to ensure services")
 		return ctrl.Result{}, err
 	}
-	if err := r.ensureShardServices(ctx, &cluster); err != nil {
-		logger.Error(err, "failed to ensure shard services")
+
+	// Ensure TLS for external endpoints (cert-manager or self-signed, if configured)
+	certRequeue, err := r.ensureCertificates(ctx, cluster)
+	if err != nil {
+		logger.Error(err, "failed to ensure certificates")
 		return ctrl.Result{}, err
 	}
 
-	// Ensure cert-manager Certificate for external endpoints (if configured)
-	if err := r.ensureCertificates(ctx, &cluster); err != nil {
-		logger.Error(err, "failed to ensure certificates")
+	// Ensure Cloudflared tunnel (if enabled)
+	if err := r.ensureCloudflared(ctx, cluster); err != nil {
+		logger.Error(err, "failed to ensure cloudflared")
 		return ctrl.Result{}, err
 	}
 
-	// Set phase Ready for now
-	cluster.Status.Phase = "Ready"
-	if err := r.Status().Update(ctx, &cluster); err != nil {
-		logger.Error(err, "failed to update status")
-		return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+	// Remove workloads of components and shards no longer in the spec
+	if err := r.pruneWorkloads(ctx, cluster); err != nil {
+		logger.Error(err, "failed to prune removed workloads")
+		return ctrl.Result{}, err
 	}
 
-	return ctrl.Result{}, nil
+	// Come back in time to rotate self-signed certificates, and soon while
+	// waiting for pods of a previous Deployment to go.
+	if waiting && (certRequeue == 0 || certRequeue > 10*time.Second) {
+		certRequeue = 10 * time.Second
+	}
+	return ctrl.Result{RequeueAfter: certRequeue}, nil
 }
 
-func (r *HonseFarmClusterReconciler) ensureCertificates(ctx context.Context, cluster *v1alpha1.HonseFarmCluster) error {
+// ensureCertificates issues the honsefarm-tls Secret, either through a
+// cert-manager Certificate or, in selfSigned mode, in-process. It returns how
+// long until the certificate should be looked at again (zero when the
+// operator does not manage renewal itself).
+func (r *HonseFarmClusterReconciler) ensureCertificates(ctx context.Context, cluster *v1alpha1.HonseFarmCluster) (time.Duration, error) {
 	// If certificates are not configured, do nothing.
 	if cluster.Spec.Certificates == nil || cluster.Spec.Certificates.Mode == "" {
-		return nil
+		setCondition(cluster, v1alpha1.ConditionCertificatesReady, metav1.ConditionTrue, "NotConfigured", "spec.certificates.mode is not set")
+		return 0, nil
 	}
 
-	ns := cluster.Spec.Namespace
-	if ns == "" {
-		ns = "honsefarm"
+	names := naming.New(cluster)
+	ns := names.Namespace()
+
+	dnsNames := certificateDNSNames(cluster)
+
+	// If we have no DNS names, nothing to issue.
+	if len(dnsNames) == 0 {
+		setCondition(cluster, v1alpha1.ConditionCertificatesReady, metav1.ConditionTrue, "NoDNSNames", "no DNS names to issue a certificate for")
+		return 0, nil
+	}
+
+	if cluster.Spec.Certificates.Mode == certificatesModeSelfSigned {
+		requeue, err := r.ensureSelfSignedCertificate(ctx, cluster, ns, dnsNames)
+		var takenErr *secretNameTakenError
+		if stderrors.As(err, &takenErr) {
+			r.Recorder.Event(cluster, corev1.EventTypeWarning, "SecretNameTaken", takenErr.Error())
+			log.FromContext(ctx).Info("TLS Secret name is taken, not issuing certificate", "error", takenErr.Error())
+			setCondition(cluster, v1alpha1.ConditionCertificatesReady, metav1.ConditionFalse, "SecretNameTaken", takenErr.Error())
+			return 0, nil
+		}
+		if err != nil {
+			setCondition(cluster, v1alpha1.ConditionCertificatesReady, metav1.ConditionFalse, "IssueFailed", err.Error())
+			return 0, err
+		}
+		setCondition(cluster, v1alpha1.ConditionCertificatesReady, metav1.ConditionTrue, "Issued", "self-signed certificate issued")
+		return requeue, nil
 	}
 
-	// Build DNS names list from spec.Certificates plus Hosts.
+	if err := r.ensureCertManagerCertificate(ctx, cluster, ns, dnsNames); err != nil {
+		setCondition(cluster, v1alpha1.ConditionCertificatesReady, metav1.ConditionFalse, "IssueFailed", err.Error())
+		return 0, err
+	}
+	ready, message, err := r.certManagerCertificateReady(ctx, ns, names.Name(tlsSecretName))
+	if err != nil {
+		return 0, err
+	}
+	if ready {
+		setCondition(cluster, v1alpha1.ConditionCertificatesReady, metav1.ConditionTrue, "Issued", message)
+		return 0, nil
+	}
+	// Certificates are not watched (cert-manager may not be installed), so
+	// poll until issuance completes.
+	setCondition(cluster, v1alpha1.ConditionCertificatesReady, metav1.ConditionFalse, "Pending", message)
+	return 30 * time.Second, nil
+}
+
+// certificateDNSNames collects the names the TLS certificate must cover:
+// explicit spec.certificates.dnsNames, spec.apiDomain, spec.hosts and any
+// Cloudflared ingress hostnames.
+func certificateDNSNames(cluster *v1alpha1.HonseFarmCluster) []string {
 	dnsNames := make([]string, 0)
 	addName := func(name string) {
 		if name == "" {
@@ -189,6 +357,8 @@ func (r *HonseFarmClusterReconciler) ensureCertificates(ctx context.Context, clu
 		addName(n)
 	}
 
+	addName(cluster.Spec.APIDomain)
+
 	// Derive from Hosts if not already present
 	if cluster.Spec.Hosts != nil {
 		addName(cluster.Spec.Hosts.Server)
@@ -199,12 +369,17 @@ func (r *HonseFarmClusterReconciler) ensureCertificates(ctx context.Context, clu
 		}
 	}
 
-	// If we still have no DNS names, nothing to issue.
-	if len(dnsNames) == 0 {
-		return nil
+	if cloudflared.Enabled(cluster) {
+		for _, rule := range cluster.Spec.Cloudflared.Ingress {
+			addName(rule.Hostname)
+		}
 	}
 
-	certName := "honsefarm-tls"
+	return dnsNames
+}
+
+func (r *HonseFarmClusterReconciler) ensureCertManagerCertificate(ctx context.Context, cluster *v1alpha1.HonseFarmCluster, ns string, dnsNames []string) error {
+	certName := naming.New(cluster).Name(tlsSecretName)
 
 	// Build desired Certificate spec.
 	spec := map[string]interface{}{
@@ -251,9 +426,7 @@ func (r *HonseFarmClusterReconciler) ensureCertificates(ctx context.Context, clu
 		}
 		cert.Object["spec"] = spec
 
-		if err := ctrl.SetControllerReference(cluster, cert, r.Scheme); err != nil {
-			return err
-		}
+		naming.New(cluster).Track(cert)
 		return r.Create(ctx, cert)
 	}
 
@@ -262,166 +435,186 @@ func (r *HonseFarmClusterReconciler) ensureCertificates(ctx context.Context, clu
 		existing.Object = map[string]interface{}{}
 	}
 	existing.Object["spec"] = spec
+	naming.New(cluster).Track(existing)
 	return r.Update(ctx, existing)
 }
 
-func (r *HonseFarmClusterReconciler) ensureCoreServices(ctx context.Context, cluster *v1alpha1.HonseFarmCluster) error {
-	ns := cluster.Spec.Namespace
-	if ns == "" {
-		ns = "honsefarm"
+func (r *HonseFarmClusterReconciler) ensureCloudflared(ctx context.Context, cluster *v1alpha1.HonseFarmCluster) error {
+	if !cloudflared.Enabled(cluster) {
+		cluster.Status.CloudflaredStatus = nil
+		return nil
 	}
 
-	// server-svc: targets honsefarm-component=server on port 5000
-	if err := r.ensureService(ctx, cluster, &corev1.Service{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      "server-svc",
-			Namespace: ns,
-			Labels: map[string]string{
-				"app.kubernetes.io/managed-by": "honsefarm-operator",
-				"app.kubernetes.io/name":       "server-svc",
-			},
-		},
-		Spec: corev1.ServiceSpec{
-			Selector: map[string]string{
-				"honsefarm-component": "server",
-			},
-			Ports: []corev1.ServicePort{
-				{
-					Name:       "http",
-					Port:       5000,
-					TargetPort: intstr.FromInt(5000),
-				},
-			},
-		},
-	}); err != nil {
+	dep, err := cloudflared.EnsureCloudflared(ctx, r.Client, cluster)
+	if err != nil {
+		cluster.Status.CloudflaredStatus = &v1alpha1.CloudflaredStatus{
+			LastError: err.Error(),
+		}
 		return err
 	}
 
-	// adminpanel-svc: targets honsefarm-component=adminpanel on port 5000
-	if err := r.ensureService(ctx, cluster, &corev1.Service{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      "adminpanel-svc",
-			Namespace: ns,
-			Labels: map[string]string{
-				"app.kubernetes.io/managed-by": "honsefarm-operator",
-				"app.kubernetes.io/name":       "adminpanel-svc",
-			},
-		},
-		Spec: corev1.ServiceSpec{
-			Selector: map[string]string{
-				"honsefarm-component": "adminpanel",
-			},
-			Ports: []corev1.ServicePort{
-				{
-					Name:       "http",
-					Port:       5000,
-					TargetPort: intstr.FromInt(5000),
-				},
-			},
-		},
-	}); err != nil {
-		return err
+	ready, lastError := cloudflared.DeploymentStatus(dep)
+	cluster.Status.CloudflaredStatus = &v1alpha1.CloudflaredStatus{
+		Ready:     ready,
+		LastError: lastError,
 	}
+	return nil
+}
+
+// ensureServices creates the Service fronting every enabled component and
+// shard.
+func (r *HonseFarmClusterReconciler) ensureServices(ctx context.Context, cluster *v1alpha1.HonseFarmCluster) error {
+	names := naming.New(cluster)
 
-	// main-fileserver-svc: targets honsefarm-component=main-fileserver on port 5001
-	if err := r.ensureService(ctx, cluster, &corev1.Service{
+	for _, w := range coreinternal.Workloads(cluster) {
+		selector := map[string]string{
+			"honsefarm-component": w.Component,
+		}
+		if w.ShardName != "" {
+			selector["honsefarm-shard"] = w.ShardName
+		}
+		// Always selected, empty without a prefix, so the Services of
+		// clusters sharing a namespace never select each other's pods.
+		selector[naming.InstanceLabel] = names.Prefix()
+		svcs := []*corev1.Service{componentService(w.Service(names), selector)}
+		if w.Kind == v1alpha1.WorkloadKindStatefulSet {
+			// Gives every StatefulSet replica a stable DNS name.
+			headless := componentService(w.Service(names).Headless(), selector)
+			headless.Spec.ClusterIP = corev1.ClusterIPNone
+			svcs = append(svcs, headless)
+		}
+		for _, svc := range svcs {
+			svc.Labels = names.WithClusterLabels(svc.Labels)
+			for k, v := range selector {
+				svc.Labels[k] = v
+			}
+			if err := r.ensureService(ctx, cluster, svc); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// componentService builds the Service described by svc, forwarding its port
+// to the same container port on the pods matching selector.
+func componentService(svc naming.Service, selector map[string]string) *corev1.Service {
+	return &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "main-fileserver-svc",
-			Namespace: ns,
+			Name:      svc.Name,
+			Namespace: svc.Namespace,
 			Labels: map[string]string{
 				"app.kubernetes.io/managed-by": "honsefarm-operator",
-				"app.kubernetes.io/name":       "main-fileserver-svc",
+				"app.kubernetes.io/name":       svc.Name,
 			},
 		},
 		Spec: corev1.ServiceSpec{
-			Selector: map[string]string{
-				"honsefarm-component": "main-fileserver",
-			},
+			Selector: selector,
 			Ports: []corev1.ServicePort{
 				{
 					Name:       "http",
-					Port:       5001,
-					TargetPort: intstr.FromInt(5001),
+					Port:       svc.Port,
+					TargetPort: intstr.FromInt(int(svc.Port)),
 				},
 			},
 		},
-	}); err != nil {
+	}
+}
+
+func (r *HonseFarmClusterReconciler) ensureService(ctx context.Context, cluster *v1alpha1.HonseFarmCluster, svc *corev1.Service) error {
+	names := naming.New(cluster)
+	names.Track(svc)
+
+	var existing corev1.Service
+	if err := r.Get(ctx, types.NamespacedName{Name: svc.Name, Namespace: svc.Namespace}, &existing); err != nil {
+		if errors.IsNotFound(err) {
+			return r.Create(ctx, svc)
+		}
 		return err
 	}
 
-	return nil
+	existing.Labels = mergeLabels(existing.Labels, svc.Labels)
+	names.Track(&existing)
+	existing.Spec.Ports = svc.Spec.Ports
+	existing.Spec.Selector = svc.Spec.Selector
+	return r.Update(ctx, &existing)
 }
 
-func (r *HonseFarmClusterReconciler) ensureShardServices(ctx context.Context, cluster *v1alpha1.HonseFarmCluster) error {
-	if cluster.Spec.Components == nil ||
-		cluster.Spec.Components.Fileservers == nil {
-		return nil
-	}
+func (r *HonseFarmClusterReconciler) ensureConfigMap(ctx context.Context, cluster *v1alpha1.HonseFarmCluster, cm *corev1.ConfigMap) error {
+	logger := log.FromContext(ctx)
 
-	ns := cluster.Spec.Namespace
-	if ns == "" {
-		ns = "honsefarm"
-	}
+	names := naming.New(cluster)
+	names.Track(cm)
 
-	for _, shard := range cluster.Spec.Components.Fileservers.Shards {
-		svcName := fmt.Sprintf("shard-%s-svc", shard.Name)
-		labels := map[string]string{
-			"app.kubernetes.io/managed-by": "honsefarm-operator",
-			"app.kubernetes.io/name":       svcName,
+	var existing corev1.ConfigMap
+	if err := r.Get(ctx, types.NamespacedName{Name: cm.Name, Namespace: cm.Namespace}, &existing); err != nil {
+		if !errors.IsNotFound(err) {
+			return err
 		}
-
-		if err := r.ensureService(ctx, cluster, &corev1.Service{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      svcName,
-				Namespace: ns,
-				Labels:    labels,
-			},
-			Spec: corev1.ServiceSpec{
-				Selector: map[string]string{
-					"honsefarm-component": "shard-fileserver",
-					"honsefarm-shard":     shard.Name,
-				},
-				Ports: []corev1.ServicePort{
-					{
-						Name:       "http",
-						Port:       5002,
-						TargetPort: intstr.FromInt(5002),
-					},
-				},
-			},
-		}); err != nil {
+		if err := r.Create(ctx, cm); err != nil {
 			return err
 		}
+		logger.Info("created honsefarm config ConfigMap", "namespace", cm.Namespace, "name", cm.Name)
+		return nil
 	}
 
-	return nil
+	existing.Labels = mergeLabels(existing.Labels, cm.Labels)
+	names.Track(&existing)
+	existing.Data = cm.Data
+	return r.Update(ctx, &existing)
 }
 
-func (r *HonseFarmClusterReconciler) ensureService(ctx context.Context, cluster *v1alpha1.HonseFarmCluster, svc *corev1.Service) error {
-	if err := ctrl.SetControllerReference(cluster, svc, r.Scheme); err != nil {
-		return err
-	}
+func (r *HonseFarmClusterReconciler) ensureSecret(ctx context.Context, cluster *v1alpha1.HonseFarmCluster, sec *corev1.Secret) error {
+	names := naming.New(cluster)
+	names.Track(sec)
 
-	var existing corev1.Service
-	if err := r.Get(ctx, types.NamespacedName{Name: svc.Name, Namespace: svc.Namespace}, &existing); err != nil {
+	var existing corev1.Secret
+	if err := r.Get(ctx, types.NamespacedName{Name: sec.Name, Namespace: sec.Namespace}, &existing); err != nil {
 		if errors.IsNotFound(err) {
-			return r.Create(ctx, svc)
+			return r.Create(ctx, sec)
 		}
 		return err
 	}
 
-	existing.Spec.Ports = svc.Spec.Ports
-	existing.Spec.Selector = svc.Spec.Selector
+	existing.Labels = mergeLabels(existing.Labels, sec.Labels)
+	names.Track(&existing)
+	existing.Data = sec.Data
 	return r.Update(ctx, &existing)
 }
 
+// mergeLabels returns existing with desired laid over it, keeping labels
+// added by others.
+func mergeLabels(existing, desired map[string]string) map[string]string {
+	if existing == nil {
+		existing = map[string]string{}
+	}
+	for k, v := range desired {
+		existing[k] = v
+	}
+	return existing
+}
+
 func (r *HonseFarmClusterReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &v1alpha1.HonseFarmCluster{}, secretRefIndex, secretRefIndexValues); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &v1alpha1.HonseFarmCluster{}, targetNamespaceIndex, targetNamespaceIndexValues); err != nil {
+		return err
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&v1alpha1.HonseFarmCluster{}).
-		Owns(&corev1.ConfigMap{}).
-		Owns(&corev1.Secret{}).
-		Owns(&corev1.Service{}).
-		Owns(&corev1.PersistentVolumeClaim{}).
-		Owns(&appsv1.Deployment{}).
+		// Children usually live in another namespace than the cluster, where
+		// owner references are not allowed; map them back through their
+		// labels instead.
+		Watches(&corev1.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(clusterForLabels)).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(clusterForLabels)).
+		Watches(&corev1.Service{}, handler.EnqueueRequestsFromMapFunc(clusterForLabels)).
+		Watches(&corev1.PersistentVolumeClaim{}, handler.EnqueueRequestsFromMapFunc(clusterForLabels)).
+		Watches(&appsv1.Deployment{}, handler.EnqueueRequestsFromMapFunc(clusterForLabels)).
+		Watches(&appsv1.StatefulSet{}, handler.EnqueueRequestsFromMapFunc(clusterForLabels)).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.clustersForSecret)).
+		Watches(&v1alpha1.HonseFarmCluster{}, handler.EnqueueRequestsFromMapFunc(r.clustersSharingNamespace)).
 		Complete(r)
 }
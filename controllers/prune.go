@@ -0,0 +1,167 @@
+package controllers
+
+import (
+	"context"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	v1alpha1 "honsefarm-operator/api/v1alpha1"
+	"honsefarm-operator/internal/cloudflared"
+	coreinternal "honsefarm-operator/internal/core"
+	"honsefarm-operator/internal/naming"
+)
+
+// pruneWorkloads deletes the Deployments, StatefulSets, Services and data
+// PVCs labelled as belonging to cluster that its spec no longer asks for, e.g.
+// after a shard is removed or a component is set to nil. A PVC is only
+// deleted when its retention policy is Delete; otherwise it is left in place
+// for the data to be recovered.
+//
+// A workload switched to workloadKind StatefulSet keeps its Deployment,
+// scaled to zero, and PVCs until the StatefulSet is ready, so switching back
+// before then still finds the data in place.
+func (r *HonseFarmClusterReconciler) pruneWorkloads(ctx context.Context, cluster *v1alpha1.HonseFarmCluster) error {
+	logger := log.FromContext(ctx)
+	names := naming.New(cluster)
+
+	deployments := map[string]bool{}
+	statefulSets := map[string]bool{}
+	services := map[string]bool{}
+	pvcs := map[string]bool{}
+	for _, w := range coreinternal.Workloads(cluster) {
+		services[w.Service(names).Name] = true
+		if w.PVCName != "" {
+			pvcs[w.PVCName] = true
+		}
+		for _, extra := range w.AdditionalPVCs {
+			pvcs[extra.Name] = true
+		}
+		if w.Kind != v1alpha1.WorkloadKindStatefulSet {
+			deployments[w.DeploymentName] = true
+			continue
+		}
+
+		statefulSets[w.DeploymentName] = true
+		services[w.Service(names).Headless().Name] = true
+		ready, err := r.statefulSetReady(ctx, names.Namespace(), w.DeploymentName)
+		if err != nil {
+			return err
+		}
+		if !ready {
+			deployments[w.DeploymentName] = true
+			for _, name := range w.LegacyPVCNames {
+				pvcs[name] = true
+			}
+		}
+	}
+	if cloudflared.Enabled(cluster) {
+		deployments[names.Name(cloudflared.DeploymentName)] = true
+	}
+
+	// Only objects carrying a component label are workloads; the config
+	// ConfigMap and Secrets are labelled for the cluster as well.
+	opts := []client.ListOption{
+		client.InNamespace(names.Namespace()),
+		client.MatchingLabels(names.ClusterLabels()),
+		client.HasLabels{"honsefarm-component"},
+	}
+
+	var depList appsv1.DeploymentList
+	if err := r.List(ctx, &depList, opts...); err != nil {
+		return err
+	}
+	for i := range depList.Items {
+		dep := &depList.Items[i]
+		if deployments[dep.Name] {
+			continue
+		}
+		if err := r.Delete(ctx, dep); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		logger.Info("deleted Deployment no longer in spec", "namespace", dep.Namespace, "name", dep.Name)
+	}
+
+	var stsList appsv1.StatefulSetList
+	if err := r.List(ctx, &stsList, opts...); err != nil {
+		return err
+	}
+	for i := range stsList.Items {
+		sts := &stsList.Items[i]
+		if statefulSets[sts.Name] {
+			continue
+		}
+		if err := r.Delete(ctx, sts); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		logger.Info("deleted StatefulSet no longer in spec", "namespace", sts.Namespace, "name", sts.Name)
+	}
+
+	var svcList corev1.ServiceList
+	if err := r.List(ctx, &svcList, opts...); err != nil {
+		return err
+	}
+	for i := range svcList.Items {
+		svc := &svcList.Items[i]
+		if services[svc.Name] {
+			continue
+		}
+		if err := r.Delete(ctx, svc); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		logger.Info("deleted Service no longer in spec", "namespace", svc.Namespace, "name", svc.Name)
+	}
+
+	var pvcList corev1.PersistentVolumeClaimList
+	if err := r.List(ctx, &pvcList, opts...); err != nil {
+		return err
+	}
+	for i := range pvcList.Items {
+		pvc := &pvcList.Items[i]
+		if pvcs[pvc.Name] || pvc.DeletionTimestamp != nil {
+			continue
+		}
+		// Replicas beyond spec.replicas, e.g. added by an autoscaler, keep
+		// their PVCs while the StatefulSet exists.
+		if statefulSets[pvc.Labels[coreinternal.StatefulSetLabel]] {
+			continue
+		}
+		if pvc.Annotations[coreinternal.RetentionPolicyAnnotation] != v1alpha1.RetentionPolicyDelete {
+			logger.V(1).Info("retaining PVC no longer in spec", "namespace", pvc.Namespace, "name", pvc.Name)
+			continue
+		}
+		if err := r.Delete(ctx, pvc); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		logger.Info("deleted PVC no longer in spec", "namespace", pvc.Namespace, "name", pvc.Name)
+	}
+
+	return nil
+}
+
+// statefulSetReady reports whether the StatefulSet has rolled out and all its
+// replicas are ready.
+func (r *HonseFarmClusterReconciler) statefulSetReady(ctx context.Context, ns, name string) (bool, error) {
+	var sts appsv1.StatefulSet
+	if err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: ns}, &sts); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	return sts.Spec.Replicas != nil && statefulSetRolledOut(&sts) && sts.Status.ReadyReplicas >= *sts.Spec.Replicas, nil
+}
+
+// clusterForLabels maps an object labelled by naming.ClusterLabels back to
+// its HonseFarmCluster.
+func clusterForLabels(_ context.Context, obj client.Object) []reconcile.Request {
+	labels := obj.GetLabels()
+	name, ok := labels[naming.ClusterLabel]
+	if !ok {
+		return nil
+	}
+	return []reconcile.Request{{
+		NamespacedName: types.NamespacedName{Name: name, Namespace: labels[naming.ClusterNamespaceLabel]},
+	}}
+}
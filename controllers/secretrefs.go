@@ -0,0 +1,146 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	v1alpha1 "honsefarm-operator/api/v1alpha1"
+	"honsefarm-operator/internal/cloudflared"
+	cfginternal "honsefarm-operator/internal/config"
+	"honsefarm-operator/internal/naming"
+)
+
+// secretRefIndex indexes HonseFarmClusters by the "<namespace>/<name>" of
+// every Secret their spec.global references.
+const secretRefIndex = "spec.global.secretRefs"
+
+// secretRefError describes a spec.global secret reference that cannot be
+// resolved.
+type secretRefError struct {
+	Field     string
+	Namespace string
+	Name      string
+	Key       string
+	// KeyMissing is false when the Secret itself does not exist.
+	KeyMissing bool
+	// Forbidden is set when the reference points into a namespace it may
+	// not; the Secret is not read then.
+	Forbidden bool
+}
+
+func (e *secretRefError) Error() string {
+	if e.Forbidden {
+		return fmt.Sprintf("%s: Secret %s/%s is outside the cluster's namespace and spec.namespace",
+			e.Field, e.Namespace, e.Name)
+	}
+	if e.KeyMissing {
+		return fmt.Sprintf("%s: key %q not found in Secret %s/%s", e.Field, e.Key, e.Namespace, e.Name)
+	}
+	return fmt.Sprintf("%s: Secret %s/%s not found", e.Field, e.Namespace, e.Name)
+}
+
+func (e *secretRefError) Reason() string {
+	if e.Forbidden {
+		return "SecretNamespaceForbidden"
+	}
+	if e.KeyMissing {
+		return "SecretKeyMissing"
+	}
+	return "SecretNotFound"
+}
+
+func secretRefNamespace(cluster *v1alpha1.HonseFarmCluster, ref *v1alpha1.SecretKeyRef) string {
+	if ref.Namespace != "" {
+		return ref.Namespace
+	}
+	return naming.New(cluster).Namespace()
+}
+
+// resolveSecretRefs reads every secret reference in spec.global. Unresolvable
+// references, and references into a namespace naming.SecretNamespaceAllowed
+// rejects, including the Cloudflared credentials, are returned as a
+// *secretRefError.
+func (r *HonseFarmClusterReconciler) resolveSecretRefs(ctx context.Context, cluster *v1alpha1.HonseFarmCluster) (map[string]string, error) {
+	names := naming.New(cluster)
+	if cloudflared.Enabled(cluster) {
+		if ref := cluster.Spec.Cloudflared.CredentialsSecretRef; ref != nil && !names.SecretNamespaceAllowed(ref.Namespace) {
+			return nil, &secretRefError{Field: "spec.cloudflared.credentialsSecretRef", Namespace: ref.Namespace,
+				Name: ref.Name, Forbidden: true}
+		}
+	}
+
+	refs := cfginternal.SecretRefs(cluster)
+
+	// Resolve in a stable order so the reported error does not flap.
+	fields := make([]string, 0, len(refs))
+	for field := range refs {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	resolved := make(map[string]string, len(refs))
+	for _, field := range fields {
+		ref := refs[field]
+		ns := secretRefNamespace(cluster, ref)
+		if !names.SecretNamespaceAllowed(ref.Namespace) {
+			return nil, &secretRefError{Field: field, Namespace: ns, Name: ref.Name, Key: ref.Key, Forbidden: true}
+		}
+
+		var sec corev1.Secret
+		if err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: ns}, &sec); err != nil {
+			if errors.IsNotFound(err) {
+				return nil, &secretRefError{Field: field, Namespace: ns, Name: ref.Name, Key: ref.Key}
+			}
+			return nil, err
+		}
+		value, ok := sec.Data[ref.Key]
+		if !ok {
+			return nil, &secretRefError{Field: field, Namespace: ns, Name: ref.Name, Key: ref.Key, KeyMissing: true}
+		}
+		resolved[field] = string(value)
+	}
+
+	return resolved, nil
+}
+
+// secretRefIndexValues is the indexer function behind secretRefIndex.
+func secretRefIndexValues(obj client.Object) []string {
+	cluster, ok := obj.(*v1alpha1.HonseFarmCluster)
+	if !ok {
+		return nil
+	}
+	var values []string
+	for _, ref := range cfginternal.SecretRefs(cluster) {
+		values = append(values, secretRefNamespace(cluster, ref)+"/"+ref.Name)
+	}
+	return values
+}
+
+// clustersForSecret maps a Secret event to the HonseFarmClusters referencing
+// that Secret, so configuration is re-rendered when it changes.
+func (r *HonseFarmClusterReconciler) clustersForSecret(ctx context.Context, obj client.Object) []reconcile.Request {
+	var clusters v1alpha1.HonseFarmClusterList
+	if err := r.List(ctx, &clusters, client.MatchingFields{
+		secretRefIndex: obj.GetNamespace() + "/" + obj.GetName(),
+	}); err != nil {
+		log.FromContext(ctx).Error(err, "failed to list HonseFarmClusters referencing Secret",
+			"namespace", obj.GetNamespace(), "name", obj.GetName())
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(clusters.Items))
+	for _, cluster := range clusters.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: cluster.Name, Namespace: cluster.Namespace},
+		})
+	}
+	return requests
+}
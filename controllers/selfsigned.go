@@ -0,0 +1,181 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	v1alpha1 "honsefarm-operator/api/v1alpha1"
+	"honsefarm-operator/internal/certs"
+	"honsefarm-operator/internal/naming"
+)
+
+// ensureSelfSignedCertificate keeps honsefarm-tls populated with a leaf
+// certificate for dnsNames signed by the operator-generated honsefarm-ca.
+// The leaf is reissued when the DNS name set changes, when it no longer
+// chains to the current CA, or once two thirds of its lifetime have passed.
+func (r *HonseFarmClusterReconciler) ensureSelfSignedCertificate(
+	ctx context.Context,
+	cluster *v1alpha1.HonseFarmCluster,
+	ns string,
+	dnsNames []string,
+) (time.Duration, error) {
+	logger := log.FromContext(ctx)
+	now := time.Now()
+	name := naming.New(cluster).Name(tlsSecretName)
+
+	// A leftover cert-manager Certificate would keep rewriting the Secret.
+	if err := r.deleteCertManagerCertificate(ctx, ns, name); err != nil {
+		return 0, err
+	}
+
+	ca, err := r.ensureSelfSignedCA(ctx, cluster, ns, now)
+	if err != nil {
+		return 0, fmt.Errorf("ensure self-signed CA: %w", err)
+	}
+
+	var existing corev1.Secret
+	err = r.Get(ctx, types.NamespacedName{Name: name, Namespace: ns}, &existing)
+	if err != nil && !errors.IsNotFound(err) {
+		return 0, err
+	}
+	if err == nil {
+		leaf, parseErr := certs.Parse(existing.Data[corev1.TLSCertKey], existing.Data[corev1.TLSPrivateKeyKey])
+		if parseErr == nil && certs.Matches(leaf) && !certs.NeedsRenewal(leaf.Cert, ca.Cert, dnsNames, now) {
+			return certs.RenewAt(leaf.Cert).Sub(now), nil
+		}
+	}
+
+	leaf, err := certs.NewLeaf(ca, dnsNames, now)
+	if err != nil {
+		return 0, fmt.Errorf("issue self-signed certificate: %w", err)
+	}
+	if err := r.ensureTLSSecret(ctx, cluster, ns, name, map[string][]byte{
+		corev1.TLSCertKey:       leaf.CertPEM,
+		corev1.TLSPrivateKeyKey: leaf.KeyPEM,
+		"ca.crt":                ca.CertPEM,
+	}); err != nil {
+		return 0, err
+	}
+	logger.Info("issued self-signed certificate", "namespace", ns, "name", name,
+		"dnsNames", dnsNames, "notAfter", leaf.Cert.NotAfter)
+
+	return certs.RenewAt(leaf.Cert).Sub(now), nil
+}
+
+// ensureSelfSignedCA loads honsefarm-ca, generating (or rotating) it when it
+// is missing, unreadable or due for renewal.
+func (r *HonseFarmClusterReconciler) ensureSelfSignedCA(
+	ctx context.Context,
+	cluster *v1alpha1.HonseFarmCluster,
+	ns string,
+	now time.Time,
+) (*certs.KeyPair, error) {
+	name := naming.New(cluster).Name(caSecretName)
+
+	var existing corev1.Secret
+	err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: ns}, &existing)
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+	if err == nil {
+		ca, parseErr := certs.Parse(existing.Data[corev1.TLSCertKey], existing.Data[corev1.TLSPrivateKeyKey])
+		if parseErr == nil && certs.Matches(ca) && now.Before(certs.RenewAt(ca.Cert)) {
+			return ca, nil
+		}
+	}
+
+	ca, err := certs.NewCA(fmt.Sprintf("%s.%s", name, ns), now)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.ensureTLSSecret(ctx, cluster, ns, name, map[string][]byte{
+		corev1.TLSCertKey:       ca.CertPEM,
+		corev1.TLSPrivateKeyKey: ca.KeyPEM,
+	}); err != nil {
+		return nil, err
+	}
+	return ca, nil
+}
+
+// secretNameTakenError reports a Secret of another type under the name of a
+// TLS Secret the operator issues. It may be the user's, so it is left alone.
+type secretNameTakenError struct {
+	Namespace string
+	Name      string
+	Type      corev1.SecretType
+}
+
+func (e *secretNameTakenError) Error() string {
+	return fmt.Sprintf("Secret %s/%s already exists with type %s, not %s; delete or rename it",
+		e.Namespace, e.Name, e.Type, corev1.SecretTypeTLS)
+}
+
+// ensureTLSSecret writes data into a kubernetes.io/tls Secret. A same-named
+// Secret of another type is not touched, since the type field is immutable,
+// and a *secretNameTakenError returned instead.
+func (r *HonseFarmClusterReconciler) ensureTLSSecret(
+	ctx context.Context,
+	cluster *v1alpha1.HonseFarmCluster,
+	ns, name string,
+	data map[string][]byte,
+) error {
+	var existing corev1.Secret
+	err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: ns}, &existing)
+	if err == nil && existing.Type == corev1.SecretTypeTLS {
+		naming.New(cluster).Track(&existing)
+		existing.Data = data
+		return r.Update(ctx, &existing)
+	}
+	if err == nil {
+		return &secretNameTakenError{Namespace: ns, Name: name, Type: existing.Type}
+	}
+	if !errors.IsNotFound(err) {
+		return err
+	}
+
+	sec := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: ns,
+			Labels: naming.New(cluster).WithClusterLabels(map[string]string{
+				"app.kubernetes.io/managed-by": "honsefarm-operator",
+				"app.kubernetes.io/name":       name,
+			}),
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: data,
+	}
+	return r.Create(ctx, sec)
+}
+
+// deleteCertManagerCertificate removes a cert-manager Certificate left over
+// from a previous certificates.mode. Clusters without cert-manager installed
+// have no Certificate kind at all, which is not an error here.
+func (r *HonseFarmClusterReconciler) deleteCertManagerCertificate(ctx context.Context, ns, name string) error {
+	cert := &unstructured.Unstructured{}
+	cert.SetGroupVersionKind(schema.GroupVersionKind{
+		Group:   "cert-manager.io",
+		Version: "v1",
+		Kind:    "Certificate",
+	})
+	if err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: ns}, cert); err != nil {
+		if errors.IsNotFound(err) || meta.IsNoMatchError(err) {
+			return nil
+		}
+		return err
+	}
+	if err := r.Delete(ctx, cert); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
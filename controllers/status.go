@@ -0,0 +1,306 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	v1alpha1 "honsefarm-operator/api/v1alpha1"
+	"honsefarm-operator/internal/cloudflared"
+	coreinternal "honsefarm-operator/internal/core"
+)
+
+const (
+	phaseReady       = "Ready"
+	phaseProgressing = "Progressing"
+	phaseDegraded    = "Degraded"
+)
+
+func setCondition(cluster *v1alpha1.HonseFarmCluster, conditionType string, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&cluster.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: cluster.Generation,
+	})
+}
+
+// updateStatus derives per-component status from the owned Deployments and
+// PVCs, sets the Ready/Progressing/Degraded conditions and persists status.
+// reconcileErr is the error (if any) the reconcile pass ended with.
+func (r *HonseFarmClusterReconciler) updateStatus(ctx context.Context, cluster *v1alpha1.HonseFarmCluster, reconcileErr error) error {
+	ns := cluster.Spec.Namespace
+
+	var components, shards []v1alpha1.WorkloadStatus
+	var notReady, progressing, failing []string
+	var storageReasons, storageIssues []string
+
+	for _, w := range coreinternal.Workloads(cluster) {
+		ws, obj, pvc, err := r.workloadStatus(ctx, ns, w)
+		if err != nil {
+			return err
+		}
+		if w.ShardName != "" {
+			shards = append(shards, ws)
+		} else {
+			components = append(components, ws)
+		}
+
+		switch {
+		case obj == nil:
+			notReady = append(notReady, ws.Name)
+		case workloadFailing(obj):
+			failing = append(failing, ws.Name)
+		case !ws.ImageRolledOut || ws.ReadyReplicas < ws.DesiredReplicas:
+			progressing = append(progressing, ws.Name)
+		}
+		if obj != nil && ws.ReadyReplicas < ws.DesiredReplicas {
+			notReady = append(notReady, ws.Name)
+		}
+		if pvc != nil && pvc.Status.Phase == corev1.ClaimLost {
+			failing = append(failing, ws.PVC.Name)
+		}
+		if pvc != nil && ws.PVC.Resizing != "" {
+			progressing = append(progressing, ws.PVC.Name)
+		}
+		if pvc != nil && w.Storage != nil {
+			reason, message, err := coreinternal.ResizeBlocker(ctx, r.Client, w.Storage, pvc)
+			if err != nil {
+				return err
+			}
+			if reason != "" {
+				storageReasons = append(storageReasons, reason)
+				storageIssues = append(storageIssues, message)
+			}
+		}
+		for _, extra := range w.AdditionalPVCs {
+			var extraPVC corev1.PersistentVolumeClaim
+			if err := r.Get(ctx, types.NamespacedName{Name: extra.Name, Namespace: ns}, &extraPVC); err != nil {
+				if errors.IsNotFound(err) {
+					continue
+				}
+				return err
+			}
+			reason, message, err := coreinternal.ResizeBlocker(ctx, r.Client, extra.Storage, &extraPVC)
+			if err != nil {
+				return err
+			}
+			if reason != "" {
+				storageReasons = append(storageReasons, reason)
+				storageIssues = append(storageIssues, message)
+			}
+		}
+	}
+
+	cluster.Status.Components = components
+	cluster.Status.Shards = shards
+	cluster.Status.ObservedGeneration = cluster.Generation
+
+	// StorageValid
+	if len(storageIssues) > 0 {
+		setCondition(cluster, v1alpha1.ConditionStorageValid, metav1.ConditionFalse, storageReasons[0],
+			strings.Join(storageIssues, "; "))
+	} else {
+		setCondition(cluster, v1alpha1.ConditionStorageValid, metav1.ConditionTrue, "Converged", "all PVCs match their storage spec")
+	}
+
+	// Progressing
+	if len(progressing) > 0 {
+		setCondition(cluster, v1alpha1.ConditionProgressing, metav1.ConditionTrue, "RollingOut",
+			"rolling out: "+strings.Join(progressing, ", "))
+	} else {
+		setCondition(cluster, v1alpha1.ConditionProgressing, metav1.ConditionFalse, "Stable", "all workloads are up to date")
+	}
+
+	// Degraded
+	switch {
+	case reconcileErr != nil:
+		setCondition(cluster, v1alpha1.ConditionDegraded, metav1.ConditionTrue, "ReconcileError", reconcileErr.Error())
+	case len(failing) > 0:
+		setCondition(cluster, v1alpha1.ConditionDegraded, metav1.ConditionTrue, "WorkloadFailing",
+			"failing: "+strings.Join(failing, ", "))
+	default:
+		setCondition(cluster, v1alpha1.ConditionDegraded, metav1.ConditionFalse, "Healthy", "no failures detected")
+	}
+
+	// Ready
+	var blockers []string
+	for _, t := range []string{v1alpha1.ConditionConfigValid, v1alpha1.ConditionCertificatesReady, v1alpha1.ConditionReplicasValid} {
+		if !meta.IsStatusConditionTrue(cluster.Status.Conditions, t) {
+			blockers = append(blockers, t+" is not True")
+		}
+	}
+	if len(notReady) > 0 {
+		blockers = append(blockers, "not ready: "+strings.Join(notReady, ", "))
+	}
+	if cs := cluster.Status.CloudflaredStatus; cs != nil && !cs.Ready && cloudflared.Enabled(cluster) {
+		blockers = append(blockers, "cloudflared is not ready")
+	}
+
+	degraded := meta.IsStatusConditionTrue(cluster.Status.Conditions, v1alpha1.ConditionDegraded)
+	switch {
+	case degraded:
+		setCondition(cluster, v1alpha1.ConditionReady, metav1.ConditionFalse, "Degraded",
+			meta.FindStatusCondition(cluster.Status.Conditions, v1alpha1.ConditionDegraded).Message)
+		cluster.Status.Phase = phaseDegraded
+	case len(blockers) > 0:
+		setCondition(cluster, v1alpha1.ConditionReady, metav1.ConditionFalse, "NotReady", strings.Join(blockers, "; "))
+		cluster.Status.Phase = phaseProgressing
+	default:
+		setCondition(cluster, v1alpha1.ConditionReady, metav1.ConditionTrue, "Ready", "all components are ready")
+		cluster.Status.Phase = phaseReady
+	}
+
+	return r.Status().Update(ctx, cluster)
+}
+
+// workloadStatus reads the Deployment (or StatefulSet) and PVC of w. Objects
+// that do not exist (yet) are returned as nil.
+func (r *HonseFarmClusterReconciler) workloadStatus(
+	ctx context.Context,
+	ns string,
+	w coreinternal.Workload,
+) (v1alpha1.WorkloadStatus, client.Object, *corev1.PersistentVolumeClaim, error) {
+	ws := v1alpha1.WorkloadStatus{
+		Name:       w.Component,
+		Component:  w.Component,
+		Deployment: w.DeploymentName,
+		Kind:       w.Kind,
+	}
+	if w.ShardName != "" {
+		ws.Name = w.ShardName
+	}
+
+	var obj client.Object
+	if w.Kind == v1alpha1.WorkloadKindStatefulSet {
+		var sts appsv1.StatefulSet
+		if err := r.Get(ctx, types.NamespacedName{Name: w.DeploymentName, Namespace: ns}, &sts); err != nil {
+			if !errors.IsNotFound(err) {
+				return ws, nil, nil, err
+			}
+		} else {
+			obj = &sts
+			if sts.Spec.Replicas != nil {
+				ws.DesiredReplicas = *sts.Spec.Replicas
+			}
+			ws.ReadyReplicas = sts.Status.ReadyReplicas
+			ws.UpdatedReplicas = sts.Status.UpdatedReplicas
+			if len(sts.Spec.Template.Spec.Containers) > 0 {
+				ws.Image = sts.Spec.Template.Spec.Containers[0].Image
+			}
+			ws.ImageRolledOut = statefulSetRolledOut(&sts)
+		}
+	} else {
+		var dep appsv1.Deployment
+		if err := r.Get(ctx, types.NamespacedName{Name: w.DeploymentName, Namespace: ns}, &dep); err != nil {
+			if !errors.IsNotFound(err) {
+				return ws, nil, nil, err
+			}
+		} else {
+			obj = &dep
+			if dep.Spec.Replicas != nil {
+				ws.DesiredReplicas = *dep.Spec.Replicas
+			}
+			ws.ReadyReplicas = dep.Status.ReadyReplicas
+			ws.UpdatedReplicas = dep.Status.UpdatedReplicas
+			if len(dep.Spec.Template.Spec.Containers) > 0 {
+				ws.Image = dep.Spec.Template.Spec.Containers[0].Image
+			}
+			ws.ImageRolledOut = dep.Status.ObservedGeneration >= dep.Generation &&
+				dep.Status.UpdatedReplicas == ws.DesiredReplicas &&
+				dep.Status.Replicas == dep.Status.UpdatedReplicas
+		}
+	}
+
+	var pvc *corev1.PersistentVolumeClaim
+	if w.PVCName != "" {
+		ws.PVC = &v1alpha1.PVCStatus{Name: w.PVCName}
+		var existingPVC corev1.PersistentVolumeClaim
+		if err := r.Get(ctx, types.NamespacedName{Name: w.PVCName, Namespace: ns}, &existingPVC); err != nil {
+			if !errors.IsNotFound(err) {
+				return ws, nil, nil, err
+			}
+		} else {
+			pvc = &existingPVC
+			ws.PVC.Phase = string(pvc.Status.Phase)
+			ws.PVC.Bound = pvc.Status.Phase == corev1.ClaimBound
+			if capacity, ok := pvc.Status.Capacity[corev1.ResourceStorage]; ok {
+				ws.PVC.Capacity = capacity.String()
+			}
+			if requested, ok := pvc.Spec.Resources.Requests[corev1.ResourceStorage]; ok {
+				ws.PVC.Requested = requested.String()
+			}
+			ws.PVC.Resizing, ws.PVC.ResizeMessage = coreinternal.ResizeProgress(pvc)
+		}
+	}
+
+	return ws, obj, pvc, nil
+}
+
+// statefulSetRolledOut reports whether every replica of sts runs the current
+// revision of its pod template.
+func statefulSetRolledOut(sts *appsv1.StatefulSet) bool {
+	return sts.Status.ObservedGeneration >= sts.Generation &&
+		sts.Status.UpdateRevision == sts.Status.CurrentRevision &&
+		sts.Status.Replicas == sts.Status.UpdatedReplicas
+}
+
+// workloadFailing reports whether the Deployment or StatefulSet obj cannot
+// make progress. StatefulSets do not report progress deadlines, so only
+// Deployments are ever considered failing.
+func workloadFailing(obj client.Object) bool {
+	if dep, ok := obj.(*appsv1.Deployment); ok {
+		return deploymentFailing(dep)
+	}
+	return false
+}
+
+// deploymentFailing reports whether a Deployment has given up progressing or
+// cannot create its pods.
+func deploymentFailing(dep *appsv1.Deployment) bool {
+	for _, cond := range dep.Status.Conditions {
+		if cond.Type == appsv1.DeploymentProgressing && cond.Status == corev1.ConditionFalse {
+			return true
+		}
+		if cond.Type == appsv1.DeploymentReplicaFailure && cond.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// certManagerCertificateReady reads the Ready condition of a cert-manager
+// Certificate.
+func (r *HonseFarmClusterReconciler) certManagerCertificateReady(ctx context.Context, ns, name string) (bool, string, error) {
+	cert := &unstructured.Unstructured{}
+	cert.SetGroupVersionKind(schema.GroupVersionKind{
+		Group:   "cert-manager.io",
+		Version: "v1",
+		Kind:    "Certificate",
+	})
+	if err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: ns}, cert); err != nil {
+		return false, "", err
+	}
+
+	conditions, _, _ := unstructured.NestedSlice(cert.Object, "status", "conditions")
+	for _, c := range conditions {
+		cond, ok := c.(map[string]interface{})
+		if !ok || cond["type"] != "Ready" {
+			continue
+		}
+		message, _ := cond["message"].(string)
+		return cond["status"] == "True", message, nil
+	}
+	return false, fmt.Sprintf("Certificate %s/%s has not reported readiness yet", ns, name), nil
+}
@@ -0,0 +1,193 @@
+package certs
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+)
+
+const (
+	// CAValidity is the lifetime of generated certificate authorities.
+	CAValidity = 10 * 365 * 24 * time.Hour
+	// LeafValidity is the lifetime of generated serving certificates.
+	LeafValidity = 90 * 24 * time.Hour
+
+	// clockSkew backdates NotBefore so freshly issued certificates are
+	// accepted by peers whose clocks lag slightly behind.
+	clockSkew = 5 * time.Minute
+)
+
+// KeyPair is a PEM-encoded certificate and private key together with their
+// parsed forms.
+type KeyPair struct {
+	CertPEM []byte
+	KeyPEM  []byte
+
+	Cert *x509.Certificate
+	Key  crypto.Signer
+}
+
+// NewCA generates a self-signed certificate authority.
+func NewCA(commonName string, now time.Time) (*KeyPair, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generate CA key: %w", err)
+	}
+	serial, err := newSerial()
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             now.Add(-clockSkew),
+		NotAfter:              now.Add(CAValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	return sign(tmpl, tmpl, key, key)
+}
+
+// NewLeaf issues a serving certificate for dnsNames signed by ca.
+func NewLeaf(ca *KeyPair, dnsNames []string, now time.Time) (*KeyPair, error) {
+	if len(dnsNames) == 0 {
+		return nil, fmt.Errorf("at least one DNS name is required")
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generate leaf key: %w", err)
+	}
+	serial, err := newSerial()
+	if err != nil {
+		return nil, err
+	}
+
+	notAfter := now.Add(LeafValidity)
+	if notAfter.After(ca.Cert.NotAfter) {
+		notAfter = ca.Cert.NotAfter
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: dnsNames[0]},
+		DNSNames:     dnsNames,
+		NotBefore:    now.Add(-clockSkew),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	return sign(tmpl, ca.Cert, key, ca.Key)
+}
+
+// Parse decodes a PEM certificate and private key.
+func Parse(certPEM, keyPEM []byte) (*KeyPair, error) {
+	certBlock, _ := pem.Decode(certPEM)
+	if certBlock == nil || certBlock.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("no PEM certificate found")
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse certificate: %w", err)
+	}
+
+	keyBlock, _ := pem.Decode(keyPEM)
+	if keyBlock == nil {
+		return nil, fmt.Errorf("no PEM private key found")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse private key: %w", err)
+	}
+	key, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", parsed)
+	}
+
+	return &KeyPair{CertPEM: certPEM, KeyPEM: keyPEM, Cert: cert, Key: key}, nil
+}
+
+// RenewAt returns the point after which cert should be replaced: once two
+// thirds of its lifetime have elapsed.
+func RenewAt(cert *x509.Certificate) time.Time {
+	lifetime := cert.NotAfter.Sub(cert.NotBefore)
+	return cert.NotBefore.Add(lifetime * 2 / 3)
+}
+
+// NeedsRenewal reports whether leaf must be reissued: it is due for
+// rotation, it no longer chains to ca, or its DNS names differ from dnsNames.
+func NeedsRenewal(leaf, ca *x509.Certificate, dnsNames []string, now time.Time) bool {
+	if !now.Before(RenewAt(leaf)) {
+		return true
+	}
+	if ca != nil && leaf.CheckSignatureFrom(ca) != nil {
+		return true
+	}
+	return !sameNames(leaf.DNSNames, dnsNames)
+}
+
+// Matches reports whether kp.Key is the private key for kp.Cert.
+func Matches(kp *KeyPair) bool {
+	pub, err := x509.MarshalPKIXPublicKey(kp.Key.Public())
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(pub, kp.Cert.RawSubjectPublicKeyInfo)
+}
+
+func sameNames(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	as := append([]string(nil), a...)
+	bs := append([]string(nil), b...)
+	sort.Strings(as)
+	sort.Strings(bs)
+	for i := range as {
+		if as[i] != bs[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func newSerial() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("generate serial number: %w", err)
+	}
+	return serial, nil
+}
+
+func sign(tmpl, parent *x509.Certificate, key *ecdsa.PrivateKey, signer crypto.Signer) (*KeyPair, error) {
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, key.Public(), signer)
+	if err != nil {
+		return nil, fmt.Errorf("create certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("parse certificate: %w", err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("marshal private key: %w", err)
+	}
+
+	return &KeyPair{
+		CertPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		KeyPEM:  pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}),
+		Cert:    cert,
+		Key:     key,
+	}, nil
+}
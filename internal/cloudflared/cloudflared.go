@@ -0,0 +1,413 @@
+package cloudflared
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	v1alpha1 "honsefarm-operator/api/v1alpha1"
+	"honsefarm-operator/internal/naming"
+)
+
+// Names of the cloudflared objects, before the spec.namePrefix.
+const (
+	ConfigMapName         = "cloudflared-config"
+	DeploymentName        = "cloudflared"
+	CredentialsSecretName = "cloudflared-credentials"
+
+	DefaultImage = "cloudflare/cloudflared:latest"
+
+	configMountPath      = "/etc/cloudflared/config"
+	credentialsMountPath = "/etc/cloudflared/creds"
+	// credentialsKey is the key cloudflared's `tunnel create` output is
+	// conventionally stored under in the credentials Secret.
+	credentialsKey = "credentials.json"
+	metricsPort    = 2000
+
+	configChecksumAnnotation = "honsefarm.io/cloudflared-config-checksum"
+)
+
+// Config is the subset of cloudflared's config.yaml the operator renders.
+type Config struct {
+	Tunnel          string        `json:"tunnel"`
+	CredentialsFile string        `json:"credentials-file"`
+	Metrics         string        `json:"metrics,omitempty"`
+	NoAutoupdate    bool          `json:"no-autoupdate,omitempty"`
+	Ingress         []IngressRule `json:"ingress"`
+}
+
+// IngressRule is a single entry of the cloudflared ingress list.
+type IngressRule struct {
+	Hostname string `json:"hostname,omitempty"`
+	Service  string `json:"service"`
+}
+
+// Enabled reports whether the cluster asks for a Cloudflared tunnel.
+func Enabled(cluster *v1alpha1.HonseFarmCluster) bool {
+	return cluster.Spec.Cloudflared != nil && cluster.Spec.Cloudflared.Enabled
+}
+
+// EnsureCloudflared reconciles the cloudflared-config ConfigMap and the
+// cloudflared Deployment. It returns the live Deployment so the caller can
+// derive status from it.
+func EnsureCloudflared(
+	ctx context.Context,
+	c client.Client,
+	cluster *v1alpha1.HonseFarmCluster,
+) (*appsv1.Deployment, error) {
+	spec := cluster.Spec.Cloudflared
+	if spec.TunnelID == "" && spec.TunnelName == "" {
+		return nil, fmt.Errorf("spec.cloudflared.tunnelId or spec.cloudflared.tunnelName must be set")
+	}
+	if spec.CredentialsSecretRef == nil || spec.CredentialsSecretRef.Name == "" {
+		return nil, fmt.Errorf("spec.cloudflared.credentialsSecretRef.name must be set")
+	}
+
+	credsSecret, err := ensureCredentials(ctx, c, cluster)
+	if err != nil {
+		return nil, fmt.Errorf("ensure cloudflared credentials: %w", err)
+	}
+
+	rendered, err := RenderConfig(cluster)
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureConfigMap(ctx, c, cluster, rendered); err != nil {
+		return nil, fmt.Errorf("ensure cloudflared config: %w", err)
+	}
+
+	sum := sha256.Sum256(rendered)
+	return ensureDeployment(ctx, c, cluster, credsSecret, hex.EncodeToString(sum[:]))
+}
+
+// RenderConfig renders config.yaml for the tunnel described by spec.cloudflared.
+func RenderConfig(cluster *v1alpha1.HonseFarmCluster) ([]byte, error) {
+	spec := cluster.Spec.Cloudflared
+
+	tunnel := spec.TunnelID
+	if tunnel == "" {
+		tunnel = spec.TunnelName
+	}
+
+	rules, err := ResolveIngress(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := Config{
+		Tunnel:          tunnel,
+		CredentialsFile: credentialsMountPath + "/" + credentialsKey,
+		Metrics:         fmt.Sprintf("0.0.0.0:%d", metricsPort),
+		NoAutoupdate:    true,
+		Ingress:         rules,
+	}
+
+	b, err := yaml.Marshal(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("marshal cloudflared config: %w", err)
+	}
+	return b, nil
+}
+
+// ensureCredentials returns the name of the Secret to mount into the
+// cloudflared pod. Secrets can only be mounted from the pod's own namespace,
+// so a reference into the cluster's own namespace is copied into the target
+// namespace. Other namespaces are refused, see
+// naming.Names.SecretNamespaceAllowed.
+func ensureCredentials(
+	ctx context.Context,
+	c client.Client,
+	cluster *v1alpha1.HonseFarmCluster,
+) (string, error) {
+	names := naming.New(cluster)
+	ns := names.Namespace()
+	name := names.Name(CredentialsSecretName)
+	ref := cluster.Spec.Cloudflared.CredentialsSecretRef
+
+	if ref.Namespace == "" || ref.Namespace == ns {
+		return ref.Name, nil
+	}
+	if !names.SecretNamespaceAllowed(ref.Namespace) {
+		return "", fmt.Errorf("credentialsSecretRef: Secret %s/%s is outside the cluster's namespace and spec.namespace",
+			ref.Namespace, ref.Name)
+	}
+
+	var src corev1.Secret
+	if err := c.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: ref.Namespace}, &src); err != nil {
+		return "", err
+	}
+
+	var existing corev1.Secret
+	if err := c.Get(ctx, types.NamespacedName{Name: name, Namespace: ns}, &existing); err != nil {
+		if !errors.IsNotFound(err) {
+			return "", err
+		}
+		sec := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: ns,
+				Labels: names.WithClusterLabels(map[string]string{
+					"app.kubernetes.io/managed-by": "honsefarm-operator",
+				}),
+			},
+			Type: corev1.SecretTypeOpaque,
+			Data: src.Data,
+		}
+		return name, c.Create(ctx, sec)
+	}
+
+	names.Track(&existing)
+	existing.Data = src.Data
+	return name, c.Update(ctx, &existing)
+}
+
+func ensureConfigMap(
+	ctx context.Context,
+	c client.Client,
+	cluster *v1alpha1.HonseFarmCluster,
+	rendered []byte,
+) error {
+	names := naming.New(cluster)
+	ns := names.Namespace()
+	name := names.Name(ConfigMapName)
+	data := map[string]string{"config.yaml": string(rendered)}
+
+	var existing corev1.ConfigMap
+	if err := c.Get(ctx, types.NamespacedName{Name: name, Namespace: ns}, &existing); err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: ns,
+				Labels: names.WithClusterLabels(map[string]string{
+					"app.kubernetes.io/managed-by": "honsefarm-operator",
+					"app.kubernetes.io/name":       name,
+				}),
+			},
+			Data: data,
+		}
+		return c.Create(ctx, cm)
+	}
+
+	names.Track(&existing)
+	existing.Data = data
+	return c.Update(ctx, &existing)
+}
+
+func ensureDeployment(
+	ctx context.Context,
+	c client.Client,
+	cluster *v1alpha1.HonseFarmCluster,
+	credsSecret string,
+	configChecksum string,
+) (*appsv1.Deployment, error) {
+	names := naming.New(cluster)
+	ns := names.Namespace()
+	name := names.Name(DeploymentName)
+	spec := cluster.Spec.Cloudflared
+
+	image := spec.Image
+	if image == "" {
+		image = DefaultImage
+	}
+
+	labels := map[string]string{
+		"app.kubernetes.io/managed-by": "honsefarm-operator",
+		"honsefarm-component":          "cloudflared",
+	}
+	// The immutable selector only carries the instance with a prefix; the
+	// pods always do, empty without one.
+	if names.Prefix() != "" {
+		labels[naming.InstanceLabel] = names.Prefix()
+	}
+	podLabels := map[string]string{naming.InstanceLabel: names.Prefix()}
+	for k, v := range labels {
+		podLabels[k] = v
+	}
+
+	args := []string{
+		"tunnel",
+		"--config", configMountPath + "/config.yaml",
+	}
+	args = append(args, spec.ExtraArgs...)
+	args = append(args, "run")
+
+	runAsNonRoot := true
+	runAsUser := int64(65532)
+	allowPrivilegeEscalation := false
+	replicas := int32(1)
+
+	template := corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: podLabels,
+			Annotations: map[string]string{
+				configChecksumAnnotation: configChecksum,
+			},
+		},
+		Spec: corev1.PodSpec{
+			SecurityContext: &corev1.PodSecurityContext{
+				RunAsNonRoot: &runAsNonRoot,
+				RunAsUser:    &runAsUser,
+				SeccompProfile: &corev1.SeccompProfile{
+					Type: corev1.SeccompProfileTypeRuntimeDefault,
+				},
+			},
+			Containers: []corev1.Container{
+				{
+					Name:  "cloudflared",
+					Image: image,
+					Args:  args,
+					Ports: []corev1.ContainerPort{
+						{
+							Name:          "metrics",
+							ContainerPort: metricsPort,
+						},
+					},
+					LivenessProbe: &corev1.Probe{
+						ProbeHandler: corev1.ProbeHandler{
+							HTTPGet: &corev1.HTTPGetAction{
+								Path: "/ready",
+								Port: intstr.FromInt(metricsPort),
+							},
+						},
+						InitialDelaySeconds: 10,
+						PeriodSeconds:       10,
+						FailureThreshold:    3,
+					},
+					ReadinessProbe: &corev1.Probe{
+						ProbeHandler: corev1.ProbeHandler{
+							HTTPGet: &corev1.HTTPGetAction{
+								Path: "/ready",
+								Port: intstr.FromInt(metricsPort),
+							},
+						},
+						PeriodSeconds: 5,
+					},
+					SecurityContext: &corev1.SecurityContext{
+						AllowPrivilegeEscalation: &allowPrivilegeEscalation,
+						RunAsNonRoot:             &runAsNonRoot,
+						RunAsUser:                &runAsUser,
+						Capabilities: &corev1.Capabilities{
+							Drop: []corev1.Capability{"ALL"},
+						},
+					},
+					VolumeMounts: []corev1.VolumeMount{
+						{
+							Name:      "config",
+							MountPath: configMountPath,
+							ReadOnly:  true,
+						},
+						{
+							Name:      "credentials",
+							MountPath: credentialsMountPath,
+							ReadOnly:  true,
+						},
+					},
+				},
+			},
+			Volumes: []corev1.Volume{
+				{
+					Name: "config",
+					VolumeSource: corev1.VolumeSource{
+						ConfigMap: &corev1.ConfigMapVolumeSource{
+							LocalObjectReference: corev1.LocalObjectReference{
+								Name: names.Name(ConfigMapName),
+							},
+						},
+					},
+				},
+				{
+					Name: "credentials",
+					VolumeSource: corev1.VolumeSource{
+						Secret: &corev1.SecretVolumeSource{
+							SecretName: credsSecret,
+						},
+					},
+				},
+			},
+		},
+	}
+
+	var existing appsv1.Deployment
+	if err := c.Get(ctx, types.NamespacedName{Name: name, Namespace: ns}, &existing); err != nil {
+		if !errors.IsNotFound(err) {
+			return nil, err
+		}
+
+		dep := &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: ns,
+				Labels:    names.WithClusterLabels(labels),
+			},
+			Spec: appsv1.DeploymentSpec{
+				Replicas: &replicas,
+				Selector: &metav1.LabelSelector{
+					MatchLabels: labels,
+				},
+				Template: template,
+			},
+		}
+		if err := c.Create(ctx, dep); err != nil {
+			return nil, err
+		}
+		return dep, nil
+	}
+
+	if existing.Labels == nil {
+		existing.Labels = map[string]string{}
+	}
+	for k, v := range labels {
+		existing.Labels[k] = v
+	}
+	names.Track(&existing)
+	existing.Spec.Replicas = &replicas
+	existing.Spec.Template = template
+	if err := c.Update(ctx, &existing); err != nil {
+		return nil, err
+	}
+	return &existing, nil
+}
+
+// DeploymentStatus derives readiness and the most relevant error message
+// from the cloudflared Deployment.
+func DeploymentStatus(dep *appsv1.Deployment) (ready bool, lastError string) {
+	if dep == nil {
+		return false, "cloudflared deployment not found"
+	}
+	for _, cond := range dep.Status.Conditions {
+		switch cond.Type {
+		case appsv1.DeploymentAvailable:
+			if cond.Status != corev1.ConditionTrue {
+				lastError = cond.Message
+			}
+		case appsv1.DeploymentProgressing:
+			if cond.Status == corev1.ConditionFalse {
+				lastError = cond.Message
+			}
+		case appsv1.DeploymentReplicaFailure:
+			if cond.Status == corev1.ConditionTrue {
+				lastError = cond.Message
+			}
+		}
+	}
+	ready = dep.Status.AvailableReplicas > 0 && dep.Status.ObservedGeneration >= dep.Generation
+	if ready {
+		lastError = ""
+	} else if lastError == "" {
+		lastError = fmt.Sprintf("%d/%d replicas available", dep.Status.AvailableReplicas, dep.Status.Replicas)
+	}
+	return ready, lastError
+}
@@ -0,0 +1,167 @@
+package cloudflared
+
+import (
+	"fmt"
+	"strings"
+
+	v1alpha1 "honsefarm-operator/api/v1alpha1"
+	"honsefarm-operator/internal/naming"
+)
+
+// Component identifiers accepted in CloudflaredIngressRule.Component.
+const (
+	ComponentServer          = "server"
+	ComponentAdminPanel      = "adminpanel"
+	ComponentMainFileserver  = "main-fileserver"
+	ComponentShardFileserver = "shard-fileserver"
+)
+
+// catchAllService terminates the ingress list; cloudflared requires the last
+// rule to match every request.
+const catchAllService = "http_status:404"
+
+func normalizeComponent(component string) string {
+	switch strings.ToLower(component) {
+	case "server":
+		return ComponentServer
+	case "adminpanel", "admin", "admin-panel":
+		return ComponentAdminPanel
+	case "main-fileserver", "mainfileserver", "main", "cdn":
+		return ComponentMainFileserver
+	case "shard-fileserver", "shardfileserver", "shard":
+		return ComponentShardFileserver
+	}
+	return component
+}
+
+// componentService maps a component (and shard name, for shard fileservers)
+// onto the Service the controller creates for it, rejecting references to
+// components or shards that are not part of the spec.
+func componentService(cluster *v1alpha1.HonseFarmCluster, component, shardName string) (naming.Service, error) {
+	comps := cluster.Spec.Components
+	names := naming.New(cluster)
+	if component == "" && shardName != "" {
+		component = ComponentShardFileserver
+	}
+
+	switch normalizeComponent(component) {
+	case ComponentServer:
+		if comps == nil || comps.Server == nil {
+			return naming.Service{}, fmt.Errorf("component %q is not enabled", component)
+		}
+		return names.ServerService(), nil
+	case ComponentAdminPanel:
+		if comps == nil || comps.AdminPanel == nil {
+			return naming.Service{}, fmt.Errorf("component %q is not enabled", component)
+		}
+		return names.AdminPanelService(), nil
+	case ComponentMainFileserver:
+		if comps == nil || comps.Fileservers == nil || comps.Fileservers.Main == nil {
+			return naming.Service{}, fmt.Errorf("component %q is not enabled", component)
+		}
+		return names.MainFileserverService(), nil
+	case ComponentShardFileserver:
+		if shardName == "" {
+			return naming.Service{}, fmt.Errorf("shardName must be set for component %q", component)
+		}
+		if comps != nil && comps.Fileservers != nil {
+			for _, shard := range comps.Fileservers.Shards {
+				if shard.Name == shardName {
+					return names.ShardService(shard.Name), nil
+				}
+			}
+		}
+		return naming.Service{}, fmt.Errorf("unknown shard %q", shardName)
+	}
+	return naming.Service{}, fmt.Errorf("unknown component %q", component)
+}
+
+// resolveRule turns a single ingress rule into a cloudflared origin.
+// specialService wins over an explicit serviceName, which wins over a
+// component/shardName reference.
+func resolveRule(cluster *v1alpha1.HonseFarmCluster, r *v1alpha1.CloudflaredIngressRule) (string, error) {
+	ns := naming.New(cluster).Namespace()
+
+	if r.SpecialService != "" {
+		return r.SpecialService, nil
+	}
+
+	if r.ServiceName != "" {
+		if r.ServicePort == 0 {
+			return "", fmt.Errorf("servicePort must be set for service %s", r.ServiceName)
+		}
+		svcNS := r.ServiceNamespace
+		if svcNS == "" {
+			svcNS = ns
+		}
+		return naming.Service{Name: r.ServiceName, Namespace: svcNS, Port: r.ServicePort}.URL(), nil
+	}
+
+	if r.Component == "" && r.ShardName == "" {
+		return "", fmt.Errorf("one of component, shardName, serviceName or specialService must be set")
+	}
+
+	svc, err := componentService(cluster, r.Component, r.ShardName)
+	if err != nil {
+		return "", err
+	}
+	if r.ServicePort != 0 {
+		svc.Port = r.ServicePort
+	}
+	return svc.URL(), nil
+}
+
+// hostRules derives ingress rules from spec.hosts for clusters that do not
+// list spec.cloudflared.ingress explicitly.
+func hostRules(cluster *v1alpha1.HonseFarmCluster) []v1alpha1.CloudflaredIngressRule {
+	hosts := cluster.Spec.Hosts
+	if hosts == nil {
+		return nil
+	}
+
+	var rules []v1alpha1.CloudflaredIngressRule
+	if hosts.Server != "" {
+		rules = append(rules, v1alpha1.CloudflaredIngressRule{Hostname: hosts.Server, Component: ComponentServer})
+	}
+	if hosts.Admin != "" {
+		rules = append(rules, v1alpha1.CloudflaredIngressRule{Hostname: hosts.Admin, Component: ComponentAdminPanel})
+	}
+	if hosts.CDN != "" {
+		rules = append(rules, v1alpha1.CloudflaredIngressRule{Hostname: hosts.CDN, Component: ComponentMainFileserver})
+	}
+	for _, sh := range hosts.Shards {
+		if sh.Host == "" {
+			continue
+		}
+		rules = append(rules, v1alpha1.CloudflaredIngressRule{Hostname: sh.Host, ShardName: sh.Name})
+	}
+	return rules
+}
+
+// ResolveIngress resolves spec.cloudflared.ingress (or, when empty, rules
+// derived from spec.hosts) into cloudflared ingress entries, always
+// terminated by the http_status:404 catch-all.
+func ResolveIngress(cluster *v1alpha1.HonseFarmCluster) ([]IngressRule, error) {
+	source := "spec.cloudflared.ingress"
+	rules := cluster.Spec.Cloudflared.Ingress
+	if len(rules) == 0 {
+		source = "spec.hosts"
+		rules = hostRules(cluster)
+	}
+
+	out := make([]IngressRule, 0, len(rules)+1)
+	for i := range rules {
+		r := &rules[i]
+		if r.Hostname == "" {
+			return nil, fmt.Errorf("%s[%d]: hostname must be set; the %s catch-all is appended automatically", source, i, catchAllService)
+		}
+		origin, err := resolveRule(cluster, r)
+		if err != nil {
+			return nil, fmt.Errorf("%s[%d] (%s): %w", source, i, r.Hostname, err)
+		}
+		out = append(out, IngressRule{Hostname: r.Hostname, Service: origin})
+	}
+
+	out = append(out, IngressRule{Service: catchAllService})
+	return out, nil
+}
@@ -1,114 +1,362 @@
 package config
 
 import (
+    "crypto/sha256"
+    "encoding/hex"
     "encoding/json"
     "fmt"
+    "strings"
 
     corev1 "k8s.io/api/core/v1"
     metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/runtime"
 
     v1alpha1 "honsefarm-operator/api/v1alpha1"
+    "honsefarm-operator/internal/naming"
+    "honsefarm-operator/internal/sizing"
 )
 
-// BuildConfigMap builds a ConfigMap containing the core HonseFarm appsettings
-// JSON files for server, adminpanel, main-fileserver and shards.
+const (
+    // ConfigMapName holds the non-sensitive appsettings of every component.
+    // Like every name below it is prefixed with spec.namePrefix.
+    ConfigMapName = "honsefarm-config"
+    // SecretName holds the sensitive appsettings values stripped from
+    // ConfigMapName.
+    SecretName = "honsefarm-config-secrets"
+
+    // Component keys used to prefix ConfigMap and Secret entries.
+    ServerComponent         = "server"
+    AdminPanelComponent     = "adminpanel"
+    MainFileserverComponent = "main-fileserver"
+
+    // AppSettingsFile is the file name ASP.NET loads in the Production
+    // environment; each component's ConfigMap entry is projected under it.
+    AppSettingsFile = "appsettings.Production.json"
+    // AppDir is the working directory of the HonseFarm images, where
+    // ASP.NET looks for AppSettingsFile.
+    AppDir = "/app"
+    // ConfigFilesDir is where the admin panel gets the whole ConfigMap,
+    // every component's configuration, mounted read-only.
+    ConfigFilesDir = "/app/config"
+)
+
+// sensitiveKeys lists the appsettings paths that carry credentials. They are
+// removed from the generated JSON and delivered as environment variables
+// from SecretName instead; ASP.NET layers environment variables
+// (Section__Key) over appsettings.*.json, so the applications see the same
+// effective configuration.
+var sensitiveKeys = [][]string{
+    {"ConnectionStrings", "Database"},
+    {"HonseFarm", "Jwt"},
+    {"HonseFarm", "RedisConnectionString"},
+    {"HonseFarm", "OpenTelemetryAnalyticsConnectionString"},
+    {"Federation", "ServerJoinSecret"},
+}
+
+// Bundle is the generated configuration for a cluster: the ConfigMap with
+// non-sensitive appsettings, the Secret with sensitive values and, per
+// component, the environment variables that pull those values back in.
+type Bundle struct {
+    ConfigMap *corev1.ConfigMap
+    Secret    *corev1.Secret
+
+    // OverrideErrors lists configOverrides that could not be applied. The
+    // affected components are rendered without their override, but the
+    // controller does not apply a Bundle with OverrideErrors at all: it keeps
+    // the current configuration and reports ConfigValid=False instead.
+    OverrideErrors []*OverrideError
+
+    secretEnv map[string][]corev1.EnvVar
+    checksums map[string]string
+}
+
+// SecretEnv returns the environment variables a component's container needs
+// to receive its sensitive settings from the generated Secret.
+func (b *Bundle) SecretEnv(component string) []corev1.EnvVar {
+    return b.secretEnv[component]
+}
+
+// Checksum returns a digest of a component's rendered appsettings and the
+// sensitive values it receives from the Secret. It only changes when that
+// component's effective configuration does.
+func (b *Bundle) Checksum(component string) string {
+    return b.checksums[component]
+}
+
+// ShardComponent returns the component key of a shard fileserver.
+func ShardComponent(name string) string {
+    return fmt.Sprintf("shard-%s", name)
+}
+
+// AppSettingsKey returns the ConfigMap key holding a component's appsettings.
+func AppSettingsKey(component string) string {
+    return fmt.Sprintf("%s.%s", component, AppSettingsFile)
+}
+
+// Build generates the ConfigMap and Secret containing the core HonseFarm
+// appsettings for server, adminpanel, main-fileserver and shards. creds
+// supplies the values used where spec.global leaves a credential empty.
 //
-// Keys:
+// ConfigMap keys:
 // - server.appsettings.Production.json
 // - adminpanel.appsettings.Production.json
 // - main-fileserver.appsettings.Production.json
 // - shard-<name>.appsettings.Production.json
-func BuildConfigMap(cluster *v1alpha1.HonseFarmCluster) (*corev1.ConfigMap, error) {
-    ns := cluster.Spec.Namespace
-    if ns == "" {
-        ns = "honsefarm"
+//
+// Secret keys are <component>.<Section__Key>, e.g.
+// server.ConnectionStrings__Database.
+func Build(cluster *v1alpha1.HonseFarmCluster, creds Credentials) (*Bundle, error) {
+    if _, err := sizing.For(cluster.Spec.SizingProfile); err != nil {
+        return nil, err
     }
 
+    names := naming.New(cluster)
+    ns := names.Namespace()
+    configMapName := names.Name(ConfigMapName)
+    secretName := names.Name(SecretName)
+
     data := map[string]string{}
+    secretData := map[string][]byte{}
+    secretEnv := map[string][]corev1.EnvVar{}
+    checksums := map[string]string{}
+    var overrideErrors []*OverrideError
+
+    // override applies a component's configOverrides, recording (rather
+    // than failing on) overrides that cannot be applied.
+    override := func(component, field string, cfg map[string]interface{}, raw *runtime.RawExtension) map[string]interface{} {
+        if raw == nil || len(raw.Raw) == 0 {
+            return cfg
+        }
+        merged, err := mergeOverride(cfg, raw.Raw)
+        if err != nil {
+            overrideErrors = append(overrideErrors, &OverrideError{Component: component, Field: field, Err: err})
+            return cfg
+        }
+        return merged
+    }
+
+    add := func(component string, cfg map[string]interface{}) error {
+        env, values, err := extractSensitive(cfg)
+        if err != nil {
+            return fmt.Errorf("extract %s secrets: %w", component, err)
+        }
+        b, err := json.Marshal(cfg)
+        if err != nil {
+            return fmt.Errorf("marshal %s config: %w", component, err)
+        }
+        data[AppSettingsKey(component)] = string(b)
+
+        sum := sha256.New()
+        sum.Write(b)
+        for i, name := range env {
+            sum.Write([]byte{0})
+            sum.Write([]byte(name))
+            sum.Write([]byte{0})
+            sum.Write(values[i])
+        }
+        checksums[component] = hex.EncodeToString(sum.Sum(nil))
+
+        for i, name := range env {
+            secretKey := fmt.Sprintf("%s.%s", component, name)
+            secretData[secretKey] = values[i]
+            secretEnv[component] = append(secretEnv[component], corev1.EnvVar{
+                Name: name,
+                ValueFrom: &corev1.EnvVarSource{
+                    SecretKeyRef: &corev1.SecretKeySelector{
+                        LocalObjectReference: corev1.LocalObjectReference{Name: secretName},
+                        Key:                  secretKey,
+                    },
+                },
+            })
+        }
+        return nil
+    }
 
     // Server config
-    serverCfg := buildServerConfig(cluster)
-    if cluster.Spec.Components != nil && cluster.Spec.Components.Server != nil && cluster.Spec.Components.Server.ConfigOverrides != nil && len(cluster.Spec.Components.Server.ConfigOverrides.Raw) > 0 {
-        serverCfg = mergeOverride(serverCfg, cluster.Spec.Components.Server.ConfigOverrides.Raw)
+    serverCfg := buildServerConfig(cluster, creds)
+    if cluster.Spec.Components != nil && cluster.Spec.Components.Server != nil {
+        serverCfg = override(ServerComponent, "spec.components.server.configOverrides", serverCfg, cluster.Spec.Components.Server.ConfigOverrides)
     }
-    if b, err := json.Marshal(serverCfg); err == nil {
-        data["server.appsettings.Production.json"] = string(b)
-    } else {
-        return nil, fmt.Errorf("marshal server config: %w", err)
+    if err := add(ServerComponent, serverCfg); err != nil {
+        return nil, err
     }
 
     // Admin panel config
-    adminCfg := buildAdminConfig(cluster)
-    if cluster.Spec.Components != nil && cluster.Spec.Components.AdminPanel != nil && cluster.Spec.Components.AdminPanel.ConfigOverrides != nil && len(cluster.Spec.Components.AdminPanel.ConfigOverrides.Raw) > 0 {
-        adminCfg = mergeOverride(adminCfg, cluster.Spec.Components.AdminPanel.ConfigOverrides.Raw)
+    adminCfg := buildAdminConfig(cluster, creds)
+    if cluster.Spec.Components != nil && cluster.Spec.Components.AdminPanel != nil {
+        adminCfg = override(AdminPanelComponent, "spec.components.adminPanel.configOverrides", adminCfg, cluster.Spec.Components.AdminPanel.ConfigOverrides)
     }
-    if b, err := json.Marshal(adminCfg); err == nil {
-        data["adminpanel.appsettings.Production.json"] = string(b)
-    } else {
-        return nil, fmt.Errorf("marshal adminpanel config: %w", err)
+    if err := add(AdminPanelComponent, adminCfg); err != nil {
+        return nil, err
     }
 
     // Main fileserver config
     if cluster.Spec.Components != nil && cluster.Spec.Components.Fileservers != nil && cluster.Spec.Components.Fileservers.Main != nil {
-        mainCfg := buildMainFileserverConfig(cluster)
-        if cluster.Spec.Components.Fileservers.Main.ConfigOverrides != nil && len(cluster.Spec.Components.Fileservers.Main.ConfigOverrides.Raw) > 0 {
-            mainCfg = mergeOverride(mainCfg, cluster.Spec.Components.Fileservers.Main.ConfigOverrides.Raw)
-        }
-        if b, err := json.Marshal(mainCfg); err == nil {
-            data["main-fileserver.appsettings.Production.json"] = string(b)
-        } else {
-            return nil, fmt.Errorf("marshal main-fileserver config: %w", err)
+        mainCfg := buildMainFileserverConfig(cluster, creds)
+        mainCfg = override(MainFileserverComponent, "spec.components.fileservers.main.configOverrides", mainCfg, cluster.Spec.Components.Fileservers.Main.ConfigOverrides)
+        if err := add(MainFileserverComponent, mainCfg); err != nil {
+            return nil, err
         }
     }
 
     // Shard configs
     if cluster.Spec.Components != nil && cluster.Spec.Components.Fileservers != nil {
-        for _, shard := range cluster.Spec.Components.Fileservers.Shards {
-            shardCfg := buildShardFileserverConfig(cluster, &shard)
-            if shard.ConfigOverrides != nil && len(shard.ConfigOverrides.Raw) > 0 {
-                shardCfg = mergeOverride(shardCfg, shard.ConfigOverrides.Raw)
-            }
-            if b, err := json.Marshal(shardCfg); err == nil {
-                key := fmt.Sprintf("%s.appsettings.Production.json", shard.Name)
-                data[key] = string(b)
-            } else {
-                return nil, fmt.Errorf("marshal shard config %s: %w", shard.Name, err)
+        for i, shard := range cluster.Spec.Components.Fileservers.Shards {
+            shardCfg := buildShardFileserverConfig(cluster, creds, &shard)
+            field := fmt.Sprintf("spec.components.fileservers.shards[%d].configOverrides", i)
+            shardCfg = override(ShardComponent(shard.Name), field, shardCfg, shard.ConfigOverrides)
+            if err := add(ShardComponent(shard.Name), shardCfg); err != nil {
+                return nil, err
             }
         }
     }
 
     cm := &corev1.ConfigMap{
         ObjectMeta: metav1.ObjectMeta{
-            Name:      "honsefarm-config",
+            Name:      configMapName,
             Namespace: ns,
-            Labels: map[string]string{
+            Labels: names.WithClusterLabels(map[string]string{
                 "app.kubernetes.io/managed-by": "honsefarm-operator",
-                "app.kubernetes.io/name":       "honsefarm-config",
-            },
+                "app.kubernetes.io/name":       configMapName,
+            }),
         },
         Data: data,
     }
 
-    return cm, nil
+    sec := &corev1.Secret{
+        ObjectMeta: metav1.ObjectMeta{
+            Name:      secretName,
+            Namespace: ns,
+            Labels: names.WithClusterLabels(map[string]string{
+                "app.kubernetes.io/managed-by": "honsefarm-operator",
+                "app.kubernetes.io/name":       secretName,
+            }),
+        },
+        Type: corev1.SecretTypeOpaque,
+        Data: secretData,
+    }
+
+    return &Bundle{ConfigMap: cm, Secret: sec, OverrideErrors: overrideErrors, secretEnv: secretEnv, checksums: checksums}, nil
 }
 
-// Shallow merge of override JSON onto base map.
-func mergeOverride(base map[string]interface{}, raw []byte) map[string]interface{} {
-    if len(raw) == 0 {
-        return base
+// extractSensitive removes every sensitiveKeys path present in cfg and
+// returns the matching environment variable names and values, in
+// sensitiveKeys order.
+func extractSensitive(cfg map[string]interface{}) ([]string, [][]byte, error) {
+    var names []string
+    var values [][]byte
+
+    for _, path := range sensitiveKeys {
+        // chain[i] is the map holding path[i].
+        chain := []map[string]interface{}{cfg}
+        for _, segment := range path[:len(path)-1] {
+            next, ok := chain[len(chain)-1][segment].(map[string]interface{})
+            if !ok {
+                break
+            }
+            chain = append(chain, next)
+        }
+        if len(chain) != len(path) {
+            continue
+        }
+        leaf := path[len(path)-1]
+        v, ok := chain[len(chain)-1][leaf]
+        if !ok {
+            continue
+        }
+        delete(chain[len(chain)-1], leaf)
+        // Drop sections that only held the secret, e.g. ConnectionStrings.
+        for i := len(chain) - 1; i > 0 && len(chain[i]) == 0; i-- {
+            delete(chain[i-1], path[i-1])
+        }
+        if v == nil {
+            continue
+        }
+
+        var value []byte
+        switch tv := v.(type) {
+        case string:
+            value = []byte(tv)
+        default:
+            b, err := json.Marshal(tv)
+            if err != nil {
+                return nil, nil, err
+            }
+            value = b
+        }
+        names = append(names, strings.Join(path, "__"))
+        values = append(values, value)
     }
-    var override map[string]interface{}
+
+    return names, values, nil
+}
+
+// OverrideError reports a configOverrides value that cannot be applied.
+type OverrideError struct {
+    Component string
+    Field     string
+    Err       error
+}
+
+func (e *OverrideError) Error() string {
+    return fmt.Sprintf("%s: %v", e.Field, e.Err)
+}
+
+func (e *OverrideError) Unwrap() error {
+    return e.Err
+}
+
+// mergeOverride applies override JSON onto base with RFC 7396 JSON Merge
+// Patch semantics: objects merge recursively, null deletes a key and any
+// other value replaces the original. The override itself must be an object.
+func mergeOverride(base map[string]interface{}, raw []byte) (map[string]interface{}, error) {
+    var override interface{}
     if err := json.Unmarshal(raw, &override); err != nil {
-        // If override is not an object, ignore it.
-        return base
+        return nil, fmt.Errorf("invalid JSON: %w", err)
     }
-    for k, v := range override {
-        base[k] = v
+    patch, ok := override.(map[string]interface{})
+    if !ok {
+        return nil, fmt.Errorf("must be a JSON object, got %s", jsonType(override))
     }
-    return base
+    return mergePatch(base, patch).(map[string]interface{}), nil
 }
 
-func buildServerConfig(cluster *v1alpha1.HonseFarmCluster) map[string]interface{} {
+func mergePatch(target interface{}, patch interface{}) interface{} {
+    patchObj, ok := patch.(map[string]interface{})
+    if !ok {
+        return patch
+    }
+    targetObj, ok := target.(map[string]interface{})
+    if !ok {
+        targetObj = map[string]interface{}{}
+    }
+    for k, v := range patchObj {
+        if v == nil {
+            delete(targetObj, k)
+            continue
+        }
+        targetObj[k] = mergePatch(targetObj[k], v)
+    }
+    return targetObj
+}
+
+func jsonType(v interface{}) string {
+    switch v.(type) {
+    case nil:
+        return "null"
+    case bool:
+        return "boolean"
+    case float64:
+        return "number"
+    case string:
+        return "string"
+    case []interface{}:
+        return "array"
+    }
+    return fmt.Sprintf("%T", v)
+}
+
+func buildServerConfig(cluster *v1alpha1.HonseFarmCluster, creds Credentials) map[string]interface{} {
     cfg := map[string]interface{}{}
 
     logging := map[string]interface{}{}
@@ -131,9 +379,7 @@ func buildServerConfig(cluster *v1alpha1.HonseFarmCluster) map[string]interface{
     }
 
     // Connection string
-    if cluster.Spec.Global != nil && cluster.Spec.Global.Database != nil {
-        db := cluster.Spec.Global.Database
-        conn := fmt.Sprintf("Host=%s;Database=%s;Username=%s;Password=%s", db.Host, db.Name, db.Username, db.Password)
+    if conn := databaseConnectionString(cluster, creds); conn != "" {
         cfg["ConnectionStrings"] = map[string]interface{}{
             "Database": conn,
         }
@@ -166,8 +412,8 @@ func buildServerConfig(cluster *v1alpha1.HonseFarmCluster) map[string]interface{
         if f.ServerType != "" {
             fed["ServerType"] = f.ServerType
         }
-        if f.ServerJoinSecret != "" {
-            fed["ServerJoinSecret"] = f.ServerJoinSecret
+        if joinSecret := serverJoinSecret(cluster, creds); joinSecret != "" {
+            fed["ServerJoinSecret"] = joinSecret
         }
         if f.ServerBaseURL != "" {
             fed["ServerBaseUrl"] = f.ServerBaseURL
@@ -187,12 +433,12 @@ func buildServerConfig(cluster *v1alpha1.HonseFarmCluster) map[string]interface{
 
     // HonseFarm core
     hf := map[string]interface{}{}
+    if jwt := jwtSecret(cluster, creds); jwt != "" {
+        hf["Jwt"] = jwt
+    }
     if cluster.Spec.Global != nil {
-        if cluster.Spec.Global.JWT != nil && cluster.Spec.Global.JWT.Secret != "" {
-            hf["Jwt"] = cluster.Spec.Global.JWT.Secret
-        }
         if cluster.Spec.Global.Redis != nil {
-            hf["RedisConnectionString"] = cluster.Spec.Global.Redis.ConnectionString
+            hf["RedisConnectionString"] = redisConnectionString(cluster, creds)
             if cluster.Spec.Global.Redis.Pool != 0 {
                 hf["RedisPool"] = cluster.Spec.Global.Redis.Pool
             }
@@ -203,34 +449,46 @@ func buildServerConfig(cluster *v1alpha1.HonseFarmCluster) map[string]interface{
                 hf["OpenTelemetryLogsEndpoint"] = t.LogsEndpoint
             }
             hf["OpenTelemetryAnalyticsOptIn"] = t.AnalyticsOptIn
-            if t.AnalyticsConnectionString != "" {
-                hf["OpenTelemetryAnalyticsConnectionString"] = t.AnalyticsConnectionString
+            if conn := analyticsConnectionString(cluster, creds); conn != "" {
+                hf["OpenTelemetryAnalyticsConnectionString"] = conn
             }
         }
     }
     // Reasonable defaults mirroring your examples
     hf["DbContextPoolSize"] = 2000
-    hf["MetricsPort"] = 4981
+    applyProfile(hf, sizing.Of(cluster).Server)
     hf["ShardName"] = "main-server"
     if cluster.Spec.Hosts != nil && cluster.Spec.Hosts.CDN != "" {
         hf["CdnFullUrl"] = fmt.Sprintf("https://%s/", cluster.Spec.Hosts.CDN)
     }
 
+    // The ports are only known with the component enabled; the entry is
+    // generated either way.
+    var server *v1alpha1.ServerComponentSpec
+    if cluster.Spec.Components != nil {
+        server = cluster.Spec.Components.Server
+    }
+    if server != nil {
+        hf["MetricsPort"] = server.MetricsPort
+    }
+
     cfg["HonseFarm"] = hf
 
     // Kestrel
-    cfg["Kestrel"] = map[string]interface{}{
-        "Endpoints": map[string]interface{}{
-            "Http": map[string]interface{}{
-                "Url": "http://*:5000",
+    if server != nil {
+        cfg["Kestrel"] = map[string]interface{}{
+            "Endpoints": map[string]interface{}{
+                "Http": map[string]interface{}{
+                    "Url": kestrelURL(server.Port),
+                },
             },
-        },
+        }
     }
 
     return cfg
 }
 
-func buildAdminConfig(cluster *v1alpha1.HonseFarmCluster) map[string]interface{} {
+func buildAdminConfig(cluster *v1alpha1.HonseFarmCluster, creds Credentials) map[string]interface{} {
     cfg := map[string]interface{}{}
 
     logging := map[string]interface{}{}
@@ -249,21 +507,19 @@ func buildAdminConfig(cluster *v1alpha1.HonseFarmCluster) map[string]interface{}
         }
     }
 
-    if cluster.Spec.Global != nil && cluster.Spec.Global.Database != nil {
-        db := cluster.Spec.Global.Database
-        conn := fmt.Sprintf("Host=%s;Database=%s;Username=%s;Password=%s", db.Host, db.Name, db.Username, db.Password)
+    if conn := databaseConnectionString(cluster, creds); conn != "" {
         cfg["ConnectionStrings"] = map[string]interface{}{
             "Database": conn,
         }
     }
 
     hf := map[string]interface{}{}
+    if jwt := jwtSecret(cluster, creds); jwt != "" {
+        hf["Jwt"] = jwt
+    }
     if cluster.Spec.Global != nil {
-        if cluster.Spec.Global.JWT != nil && cluster.Spec.Global.JWT.Secret != "" {
-            hf["Jwt"] = cluster.Spec.Global.JWT.Secret
-        }
         if cluster.Spec.Global.Redis != nil {
-            hf["RedisConnectionString"] = cluster.Spec.Global.Redis.ConnectionString
+            hf["RedisConnectionString"] = redisConnectionString(cluster, creds)
             if cluster.Spec.Global.Redis.Pool != 0 {
                 hf["RedisPool"] = cluster.Spec.Global.Redis.Pool
             }
@@ -275,15 +531,25 @@ func buildAdminConfig(cluster *v1alpha1.HonseFarmCluster) map[string]interface{}
         hf["MainServerUrl"] = fmt.Sprintf("https://%s", cluster.Spec.Hosts.Server)
     }
 
-    hf["ConfigFilesPath"] = "/app/config"
+    hf["ConfigFilesPath"] = ConfigFilesDir
 
     cfg["HonseFarm"] = hf
     cfg["AllowedHosts"] = "*"
 
+    if cluster.Spec.Components != nil && cluster.Spec.Components.AdminPanel != nil {
+        cfg["Kestrel"] = map[string]interface{}{
+            "Endpoints": map[string]interface{}{
+                "Http": map[string]interface{}{
+                    "Url": kestrelURL(cluster.Spec.Components.AdminPanel.Port),
+                },
+            },
+        }
+    }
+
     return cfg
 }
 
-func buildMainFileserverConfig(cluster *v1alpha1.HonseFarmCluster) map[string]interface{} {
+func buildMainFileserverConfig(cluster *v1alpha1.HonseFarmCluster, creds Credentials) map[string]interface{} {
     cfg := map[string]interface{}{}
 
     logging := map[string]interface{}{}
@@ -302,21 +568,19 @@ func buildMainFileserverConfig(cluster *v1alpha1.HonseFarmCluster) map[string]in
         }
     }
 
-    if cluster.Spec.Global != nil && cluster.Spec.Global.Database != nil {
-        db := cluster.Spec.Global.Database
-        conn := fmt.Sprintf("Host=%s;Database=%s;Username=%s;Password=%s", db.Host, db.Name, db.Username, db.Password)
+    if conn := databaseConnectionString(cluster, creds); conn != "" {
         cfg["ConnectionStrings"] = map[string]interface{}{
             "Database": conn,
         }
     }
 
     hf := map[string]interface{}{}
+    if jwt := jwtSecret(cluster, creds); jwt != "" {
+        hf["Jwt"] = jwt
+    }
     if cluster.Spec.Global != nil {
-        if cluster.Spec.Global.JWT != nil && cluster.Spec.Global.JWT.Secret != "" {
-            hf["Jwt"] = cluster.Spec.Global.JWT.Secret
-        }
         if cluster.Spec.Global.Redis != nil {
-            hf["RedisConnectionString"] = cluster.Spec.Global.Redis.ConnectionString
+            hf["RedisConnectionString"] = redisConnectionString(cluster, creds)
         }
         if cluster.Spec.Global.Telemetry != nil {
             t := cluster.Spec.Global.Telemetry
@@ -324,8 +588,8 @@ func buildMainFileserverConfig(cluster *v1alpha1.HonseFarmCluster) map[string]in
                 hf["OpenTelemetryLogsEndpoint"] = t.LogsEndpoint
             }
             hf["OpenTelemetryAnalyticsOptIn"] = t.AnalyticsOptIn
-            if t.AnalyticsConnectionString != "" {
-                hf["OpenTelemetryAnalyticsConnectionString"] = t.AnalyticsConnectionString
+            if conn := analyticsConnectionString(cluster, creds); conn != "" {
+                hf["OpenTelemetryAnalyticsConnectionString"] = conn
             }
         }
     }
@@ -337,21 +601,25 @@ func buildMainFileserverConfig(cluster *v1alpha1.HonseFarmCluster) map[string]in
         hf["ServerUri"] = fmt.Sprintf("https://%s", cluster.Spec.Hosts.CDN)
         hf["CdnFullUrl"] = fmt.Sprintf("https://%s", cluster.Spec.Hosts.CDN)
     }
-    hf["CacheDirectory"] = "/cache"
-    hf["CacheSizeHardLimitInGiB"] = 10
+    main := cluster.Spec.Components.Fileservers.Main
+    hf["CacheDirectory"] = CacheDirectory
+    hf["CacheSizeHardLimitInGiB"] = v1alpha1.DefaultMainFileserverCacheSizeHardLimitInGiB
     hf["UseColdStorage"] = false
     hf["DownloadQueueSize"] = 100
     hf["DownloadQueueReleaseSeconds"] = 300
     hf["DbContextPoolSize"] = 512
-    hf["MainServerAddress"] = "http://server:5000"
-    hf["MetricsPort"] = 4982
+    applyProfile(hf, sizing.Of(cluster).MainFileserver)
+    applyCacheLimit(hf, main.CacheSizeHardLimitInGiB)
+    applyFileserverVolumes(hf, main.Cache, main.ColdStorage)
+    hf["MainServerAddress"] = naming.New(cluster).ServerService().URL()
+    hf["MetricsPort"] = main.MetricsPort
 
     cfg["HonseFarm"] = hf
 
     cfg["Kestrel"] = map[string]interface{}{
         "Endpoints": map[string]interface{}{
             "Http": map[string]interface{}{
-                "Url": "http://*:5001",
+                "Url": kestrelURL(main.Port),
             },
         },
     }
@@ -359,7 +627,7 @@ func buildMainFileserverConfig(cluster *v1alpha1.HonseFarmCluster) map[string]in
     return cfg
 }
 
-func buildShardFileserverConfig(cluster *v1alpha1.HonseFarmCluster, shard *v1alpha1.ShardSpec) map[string]interface{} {
+func buildShardFileserverConfig(cluster *v1alpha1.HonseFarmCluster, creds Credentials, shard *v1alpha1.ShardSpec) map[string]interface{} {
     cfg := map[string]interface{}{}
 
     logging := map[string]interface{}{}
@@ -378,21 +646,19 @@ func buildShardFileserverConfig(cluster *v1alpha1.HonseFarmCluster, shard *v1alp
         }
     }
 
-    if cluster.Spec.Global != nil && cluster.Spec.Global.Database != nil {
-        db := cluster.Spec.Global.Database
-        conn := fmt.Sprintf("Host=%s;Database=%s;Username=%s;Password=%s", db.Host, db.Name, db.Username, db.Password)
+    if conn := databaseConnectionString(cluster, creds); conn != "" {
         cfg["ConnectionStrings"] = map[string]interface{}{
             "Database": conn,
         }
     }
 
     hf := map[string]interface{}{}
+    if jwt := jwtSecret(cluster, creds); jwt != "" {
+        hf["Jwt"] = jwt
+    }
     if cluster.Spec.Global != nil {
-        if cluster.Spec.Global.JWT != nil && cluster.Spec.Global.JWT.Secret != "" {
-            hf["Jwt"] = cluster.Spec.Global.JWT.Secret
-        }
         if cluster.Spec.Global.Redis != nil {
-            hf["RedisConnectionString"] = cluster.Spec.Global.Redis.ConnectionString
+            hf["RedisConnectionString"] = redisConnectionString(cluster, creds)
         }
         if cluster.Spec.Global.Telemetry != nil {
             t := cluster.Spec.Global.Telemetry
@@ -400,8 +666,8 @@ func buildShardFileserverConfig(cluster *v1alpha1.HonseFarmCluster, shard *v1alp
                 hf["OpenTelemetryLogsEndpoint"] = t.LogsEndpoint
             }
             hf["OpenTelemetryAnalyticsOptIn"] = t.AnalyticsOptIn
-            if t.AnalyticsConnectionString != "" {
-                hf["OpenTelemetryAnalyticsConnectionString"] = t.AnalyticsConnectionString
+            if conn := analyticsConnectionString(cluster, creds); conn != "" {
+                hf["OpenTelemetryAnalyticsConnectionString"] = conn
             }
         }
     }
@@ -419,8 +685,8 @@ func buildShardFileserverConfig(cluster *v1alpha1.HonseFarmCluster, shard *v1alp
     }
     hf["FileServerName"] = shardHost
     hf["ServerUri"] = fmt.Sprintf("https://%s", shardHost)
-    hf["CacheDirectory"] = "/cache"
-    hf["CacheSizeHardLimitInGiB"] = 100
+    hf["CacheDirectory"] = CacheDirectory
+    hf["CacheSizeHardLimitInGiB"] = v1alpha1.DefaultShardFileserverCacheSizeHardLimitInGiB
     hf["UseColdStorage"] = false
     hf["ColdStorageDirectory"] = nil
     hf["ColdStorageSizeHardLimitInGiB"] = 0
@@ -429,10 +695,14 @@ func buildShardFileserverConfig(cluster *v1alpha1.HonseFarmCluster, shard *v1alp
     hf["DownloadQueueSize"] = 100
     hf["DownloadQueueReleaseSeconds"] = 300
     hf["DbContextPoolSize"] = 512
-    hf["MainServerAddress"] = "http://server:5000"
-    hf["MainFileServerAddress"] = "http://main-fileserver:5001"
-    hf["DistributionFileServerAddress"] = "http://main-fileserver:5001"
-    hf["MetricsPort"] = 4983
+    applyProfile(hf, sizing.Of(cluster).ShardFileserver)
+    applyCacheLimit(hf, shard.CacheSizeHardLimitInGiB)
+    applyFileserverVolumes(hf, shard.Cache, shard.ColdStorage)
+    names := naming.New(cluster)
+    hf["MainServerAddress"] = names.ServerService().URL()
+    hf["MainFileServerAddress"] = names.MainFileserverService().URL()
+    hf["DistributionFileServerAddress"] = names.MainFileserverService().URL()
+    hf["MetricsPort"] = shard.MetricsPort
 
     // Simple shard configuration stub; can be overridden via configOverrides.
     hf["ShardConfiguration"] = map[string]interface{}{
@@ -448,10 +718,34 @@ func buildShardFileserverConfig(cluster *v1alpha1.HonseFarmCluster, shard *v1alp
     cfg["Kestrel"] = map[string]interface{}{
         "Endpoints": map[string]interface{}{
             "Http": map[string]interface{}{
-                "Url": "http://*:5002",
+                "Url": kestrelURL(shard.Port),
             },
         },
     }
 
     return cfg
 }
+
+// applyProfile sets the pool and cache sizes preset by the sizing profile.
+// cacheSizeHardLimitInGiB and a sized cache volume still take precedence
+// over the cache preset.
+func applyProfile(hf map[string]interface{}, preset sizing.Component) {
+    if preset.DbContextPoolSize != 0 {
+        hf["DbContextPoolSize"] = preset.DbContextPoolSize
+    }
+    if preset.CacheSizeHardLimitInGiB != 0 {
+        hf["CacheSizeHardLimitInGiB"] = preset.CacheSizeHardLimitInGiB
+    }
+}
+
+// applyCacheLimit sets the cacheSizeHardLimitInGiB of a fileserver spec.
+func applyCacheLimit(hf map[string]interface{}, limit int64) {
+    if limit != 0 {
+        hf["CacheSizeHardLimitInGiB"] = limit
+    }
+}
+
+// kestrelURL is the Kestrel endpoint listening on port on all interfaces.
+func kestrelURL(port int32) string {
+    return fmt.Sprintf("http://*:%d", port)
+}
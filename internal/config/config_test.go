@@ -0,0 +1,149 @@
+package config
+
+import (
+    "encoding/json"
+    "reflect"
+    "testing"
+)
+
+// decode parses a JSON object the way configOverrides are parsed.
+func decode(t *testing.T, s string) map[string]interface{} {
+    t.Helper()
+    var out map[string]interface{}
+    if err := json.Unmarshal([]byte(s), &out); err != nil {
+        t.Fatalf("decode %s: %v", s, err)
+    }
+    return out
+}
+
+func TestMergePatch(t *testing.T) {
+    tests := []struct {
+        name   string
+        target string
+        patch  string
+        want   string
+    }{
+        {
+            name:   "adds keys",
+            target: `{"a": 1}`,
+            patch:  `{"b": 2}`,
+            want:   `{"a": 1, "b": 2}`,
+        },
+        {
+            name:   "replaces scalars",
+            target: `{"a": 1}`,
+            patch:  `{"a": "one"}`,
+            want:   `{"a": "one"}`,
+        },
+        {
+            name:   "merges nested objects",
+            target: `{"HonseFarm": {"RedisPool": 10, "MainServerUrl": "https://a"}}`,
+            patch:  `{"HonseFarm": {"RedisPool": 20}}`,
+            want:   `{"HonseFarm": {"RedisPool": 20, "MainServerUrl": "https://a"}}`,
+        },
+        {
+            name:   "null deletes",
+            target: `{"a": 1, "b": {"c": 2, "d": 3}}`,
+            patch:  `{"a": null, "b": {"c": null}}`,
+            want:   `{"b": {"d": 3}}`,
+        },
+        {
+            name:   "replaces arrays whole",
+            target: `{"a": [1, 2, 3]}`,
+            patch:  `{"a": [4]}`,
+            want:   `{"a": [4]}`,
+        },
+        {
+            name:   "object replaces scalar",
+            target: `{"a": 1}`,
+            patch:  `{"a": {"b": 2, "c": null}}`,
+            want:   `{"a": {"b": 2}}`,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got := mergePatch(decode(t, tt.target), decode(t, tt.patch))
+            if want := decode(t, tt.want); !reflect.DeepEqual(got, want) {
+                t.Errorf("mergePatch() = %v, want %v", got, want)
+            }
+        })
+    }
+}
+
+func TestExtractSensitive(t *testing.T) {
+    tests := []struct {
+        name       string
+        cfg        string
+        want       string
+        wantNames  []string
+        wantValues []string
+    }{
+        {
+            name: "nothing sensitive",
+            cfg:  `{"HonseFarm": {"RedisPool": 10}}`,
+            want: `{"HonseFarm": {"RedisPool": 10}}`,
+        },
+        {
+            name:       "drops sections left empty",
+            cfg:        `{"ConnectionStrings": {"Database": "Host=db"}, "HonseFarm": {"RedisPool": 10}}`,
+            want:       `{"HonseFarm": {"RedisPool": 10}}`,
+            wantNames:  []string{"ConnectionStrings__Database"},
+            wantValues: []string{"Host=db"},
+        },
+        {
+            name:       "keeps the rest of a section",
+            cfg:        `{"HonseFarm": {"RedisConnectionString": "redis:6379", "RedisPool": 10}}`,
+            want:       `{"HonseFarm": {"RedisPool": 10}}`,
+            wantNames:  []string{"HonseFarm__RedisConnectionString"},
+            wantValues: []string{"redis:6379"},
+        },
+        {
+            name:       "marshals non-strings",
+            cfg:        `{"HonseFarm": {"Jwt": {"Secret": "s"}}}`,
+            want:       `{}`,
+            wantNames:  []string{"HonseFarm__Jwt"},
+            wantValues: []string{`{"Secret":"s"}`},
+        },
+        {
+            name: "null is removed without a value",
+            cfg:  `{"Federation": {"ServerJoinSecret": null}}`,
+            want: `{}`,
+        },
+        {
+            name: "parent of the wrong type",
+            cfg:  `{"ConnectionStrings": "none"}`,
+            want: `{"ConnectionStrings": "none"}`,
+        },
+        {
+            name:       "sensitiveKeys order",
+            cfg:        `{"Federation": {"ServerJoinSecret": "join"}, "ConnectionStrings": {"Database": "Host=db"}}`,
+            want:       `{}`,
+            wantNames:  []string{"ConnectionStrings__Database", "Federation__ServerJoinSecret"},
+            wantValues: []string{"Host=db", "join"},
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg := decode(t, tt.cfg)
+            names, values, err := extractSensitive(cfg)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if want := decode(t, tt.want); !reflect.DeepEqual(cfg, want) {
+                t.Errorf("remaining config = %v, want %v", cfg, want)
+            }
+            if !reflect.DeepEqual(names, tt.wantNames) {
+                t.Errorf("names = %v, want %v", names, tt.wantNames)
+            }
+            var gotValues []string
+            for _, v := range values {
+                gotValues = append(gotValues, string(v))
+            }
+            if !reflect.DeepEqual(gotValues, tt.wantValues) {
+                t.Errorf("values = %v, want %v", gotValues, tt.wantValues)
+            }
+        })
+    }
+}
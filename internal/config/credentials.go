@@ -0,0 +1,122 @@
+package config
+
+import (
+    "fmt"
+    "strings"
+
+    v1alpha1 "honsefarm-operator/api/v1alpha1"
+)
+
+// Field paths of the spec.global secret references, used as keys of
+// Credentials.Resolved.
+const (
+    DatabasePasswordRef          = "spec.global.database.passwordSecretRef"
+    JWTSecretRef                 = "spec.global.jwt.secretRef"
+    RedisConnectionStringRef     = "spec.global.redis.connectionStringSecretRef"
+    AnalyticsConnectionStringRef = "spec.global.telemetry.analyticsConnectionStringSecretRef"
+    ServerJoinSecretRef          = "spec.global.federation.serverJoinSecretRef"
+)
+
+// Credentials are the sensitive inputs of config generation that do not
+// come from plain spec fields.
+//
+// For every credential the order of precedence is: the value read through
+// its secret reference, the plain spec.global field, then (where one exists)
+// the operator-generated honsefarm-secrets value.
+type Credentials struct {
+    // Generated honsefarm-secrets values.
+    JWTSecret        string
+    DatabasePassword string
+    RedisPassword    string
+
+    // Resolved holds the values read from spec.global secret references,
+    // keyed by the *Ref field paths above.
+    Resolved map[string]string
+}
+
+// SecretRefs returns the secret references set in spec.global, keyed by
+// field path.
+func SecretRefs(cluster *v1alpha1.HonseFarmCluster) map[string]*v1alpha1.SecretKeyRef {
+    refs := map[string]*v1alpha1.SecretKeyRef{}
+    g := cluster.Spec.Global
+    if g == nil {
+        return refs
+    }
+    if g.Database != nil && g.Database.PasswordSecretRef != nil {
+        refs[DatabasePasswordRef] = g.Database.PasswordSecretRef
+    }
+    if g.JWT != nil && g.JWT.SecretRef != nil {
+        refs[JWTSecretRef] = g.JWT.SecretRef
+    }
+    if g.Redis != nil && g.Redis.ConnectionStringSecretRef != nil {
+        refs[RedisConnectionStringRef] = g.Redis.ConnectionStringSecretRef
+    }
+    if g.Telemetry != nil && g.Telemetry.AnalyticsConnectionStringSecretRef != nil {
+        refs[AnalyticsConnectionStringRef] = g.Telemetry.AnalyticsConnectionStringSecretRef
+    }
+    if g.Federation != nil && g.Federation.ServerJoinSecretRef != nil {
+        refs[ServerJoinSecretRef] = g.Federation.ServerJoinSecretRef
+    }
+    return refs
+}
+
+func (c Credentials) resolve(ref, value, generated string) string {
+    if v, ok := c.Resolved[ref]; ok {
+        return v
+    }
+    if value != "" {
+        return value
+    }
+    return generated
+}
+
+func databaseConnectionString(cluster *v1alpha1.HonseFarmCluster, creds Credentials) string {
+    if cluster.Spec.Global == nil || cluster.Spec.Global.Database == nil {
+        return ""
+    }
+    db := cluster.Spec.Global.Database
+    password := creds.resolve(DatabasePasswordRef, db.Password, creds.DatabasePassword)
+    return fmt.Sprintf("Host=%s;Database=%s;Username=%s;Password=%s", db.Host, db.Name, db.Username, password)
+}
+
+func jwtSecret(cluster *v1alpha1.HonseFarmCluster, creds Credentials) string {
+    secret := ""
+    if cluster.Spec.Global != nil && cluster.Spec.Global.JWT != nil {
+        secret = cluster.Spec.Global.JWT.Secret
+    }
+    return creds.resolve(JWTSecretRef, secret, creds.JWTSecret)
+}
+
+// redisConnectionString returns the Redis connection string. The generated
+// password is only added, to a connection string without one, with
+// redis.useGeneratedPassword: nothing configures another Redis with it.
+func redisConnectionString(cluster *v1alpha1.HonseFarmCluster, creds Credentials) string {
+    if cluster.Spec.Global == nil || cluster.Spec.Global.Redis == nil {
+        return ""
+    }
+    redis := cluster.Spec.Global.Redis
+    conn := creds.resolve(RedisConnectionStringRef, redis.ConnectionString, "")
+    if conn == "" || !redis.UseGeneratedPassword || creds.RedisPassword == "" {
+        return conn
+    }
+    for _, opt := range strings.Split(conn, ",") {
+        if strings.HasPrefix(strings.ToLower(strings.TrimSpace(opt)), "password=") {
+            return conn
+        }
+    }
+    return conn + ",password=" + creds.RedisPassword
+}
+
+func analyticsConnectionString(cluster *v1alpha1.HonseFarmCluster, creds Credentials) string {
+    if cluster.Spec.Global == nil || cluster.Spec.Global.Telemetry == nil {
+        return ""
+    }
+    return creds.resolve(AnalyticsConnectionStringRef, cluster.Spec.Global.Telemetry.AnalyticsConnectionString, "")
+}
+
+func serverJoinSecret(cluster *v1alpha1.HonseFarmCluster, creds Credentials) string {
+    if cluster.Spec.Global == nil || cluster.Spec.Global.Federation == nil {
+        return ""
+    }
+    return creds.resolve(ServerJoinSecretRef, cluster.Spec.Global.Federation.ServerJoinSecret, "")
+}
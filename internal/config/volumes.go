@@ -0,0 +1,77 @@
+package config
+
+import (
+    "k8s.io/apimachinery/pkg/api/resource"
+
+    v1alpha1 "honsefarm-operator/api/v1alpha1"
+)
+
+const (
+    // CacheDirectory is where a fileserver's cache volume is mounted.
+    CacheDirectory = "/cache"
+    // ColdStorageDirectory is where a fileserver's cold-storage volume is
+    // mounted.
+    ColdStorageDirectory = "/coldstorage"
+)
+
+// VolumeSize returns the size of a fileserver volume: the PVC or ephemeral
+// request, or the emptyDir size limit. ok is false when the volume has no
+// valid size.
+func VolumeSize(v *v1alpha1.FileserverVolumeSpec) (size resource.Quantity, ok bool) {
+    if v == nil {
+        return size, false
+    }
+    var raw string
+    switch {
+    case v.PVC != nil:
+        raw = v.PVC.Size
+    case v.Ephemeral != nil:
+        raw = v.Ephemeral.Size
+    case v.EmptyDir != nil:
+        raw = v.EmptyDir.SizeLimit
+    }
+    if raw == "" {
+        return size, false
+    }
+    size, err := resource.ParseQuantity(raw)
+    if err != nil {
+        return size, false
+    }
+    return size, true
+}
+
+// sizeLimitGiB turns a volume size into the directory size limit the
+// fileserver enforces, keeping 10% (at least 1GiB) of headroom for
+// filesystem overhead and downloads in flight.
+func sizeLimitGiB(v *v1alpha1.FileserverVolumeSpec) (int64, bool) {
+    size, ok := VolumeSize(v)
+    if !ok {
+        return 0, false
+    }
+    gib := size.Value() >> 30
+    headroom := gib / 10
+    if headroom < 1 {
+        headroom = 1
+    }
+    limit := gib - headroom
+    if limit < 1 {
+        limit = 1
+    }
+    return limit, true
+}
+
+// applyFileserverVolumes points the cache and cold-storage settings of a
+// fileserver config at its volumes. Without a sized cache volume the
+// builder's default limit is kept.
+func applyFileserverVolumes(hf map[string]interface{}, cache, coldStorage *v1alpha1.FileserverVolumeSpec) {
+    if limit, ok := sizeLimitGiB(cache); ok {
+        hf["CacheSizeHardLimitInGiB"] = limit
+    }
+    if coldStorage != nil {
+        hf["UseColdStorage"] = true
+        hf["ColdStorageDirectory"] = ColdStorageDirectory
+        if limit, ok := sizeLimitGiB(coldStorage); ok {
+            hf["ColdStorageSizeHardLimitInGiB"] = limit
+        }
+    }
+}
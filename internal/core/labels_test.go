@@ -0,0 +1,35 @@
+package core
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// TestPodLabelsSeparateInstances checks that the pod-level selectors of a
+// prefixed and an unprefixed cluster sharing a namespace only select their
+// own pods.
+func TestPodLabelsSeparateInstances(t *testing.T) {
+	for _, shard := range []string{"", "eu"} {
+		component := ComponentServer
+		if shard != "" {
+			component = ComponentShardFileserver
+		}
+		prod := podLabels("", component, shard)
+		staging := podLabels("staging", component, shard)
+
+		if !labels.SelectorFromSet(prod).Matches(labels.Set(prod)) {
+			t.Errorf("shard %q: unprefixed selector does not match its own pods", shard)
+		}
+		if labels.SelectorFromSet(prod).Matches(labels.Set(staging)) {
+			t.Errorf("shard %q: unprefixed selector matches the prefixed cluster's pods", shard)
+		}
+		if labels.SelectorFromSet(staging).Matches(labels.Set(prod)) {
+			t.Errorf("shard %q: prefixed selector matches the unprefixed cluster's pods", shard)
+		}
+		// The immutable workload selector must keep matching the pods.
+		if !labels.SelectorFromSet(componentLabels("", component, shard)).Matches(labels.Set(prod)) {
+			t.Errorf("shard %q: workload selector does not match the pod template", shard)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package core
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	v1alpha1 "honsefarm-operator/api/v1alpha1"
+)
+
+// Topology keys of the default spread of a workload's replicas.
+const (
+	hostnameTopologyKey = "kubernetes.io/hostname"
+	zoneTopologyKey     = "topology.kubernetes.io/zone"
+)
+
+// applyScheduling places the pods of spec. Without an explicit affinity or
+// topology spread, replicas of the same workload prefer different nodes and
+// spread across zones where the cluster has them. Both defaults are soft, so
+// a single node or zone still runs every replica.
+func applyScheduling(pod *corev1.PodSpec, spec *DeploymentSpec) {
+	selector := &metav1.LabelSelector{
+		MatchLabels: podLabels(spec.Instance, spec.Component, spec.ShardName),
+	}
+
+	scheduling := spec.Scheduling
+	if scheduling == nil {
+		scheduling = &v1alpha1.SchedulingSpec{}
+	}
+
+	pod.NodeSelector = scheduling.NodeSelector
+	pod.Tolerations = scheduling.Tolerations
+	pod.PriorityClassName = scheduling.PriorityClassName
+
+	pod.Affinity = scheduling.Affinity
+	if pod.Affinity == nil {
+		pod.Affinity = &corev1.Affinity{
+			PodAntiAffinity: &corev1.PodAntiAffinity{
+				PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{
+					{
+						Weight: 100,
+						PodAffinityTerm: corev1.PodAffinityTerm{
+							LabelSelector: selector,
+							TopologyKey:   hostnameTopologyKey,
+						},
+					},
+				},
+			},
+		}
+	}
+
+	if len(scheduling.TopologySpreadConstraints) == 0 {
+		pod.TopologySpreadConstraints = []corev1.TopologySpreadConstraint{
+			{
+				MaxSkew:           1,
+				TopologyKey:       zoneTopologyKey,
+				WhenUnsatisfiable: corev1.ScheduleAnyway,
+				LabelSelector:     selector,
+			},
+		}
+		return
+	}
+	for _, constraint := range scheduling.TopologySpreadConstraints {
+		if constraint.LabelSelector == nil {
+			constraint.LabelSelector = selector
+		}
+		pod.TopologySpreadConstraints = append(pod.TopologySpreadConstraints, constraint)
+	}
+}
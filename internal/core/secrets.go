@@ -7,54 +7,92 @@ import (
 
     corev1 "k8s.io/api/core/v1"
     "k8s.io/apimachinery/pkg/api/errors"
-    "k8s.io/apimachinery/pkg/types"
     metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/types"
     "sigs.k8s.io/controller-runtime/pkg/client"
 
     v1alpha1 "honsefarm-operator/api/v1alpha1"
+    cfginternal "honsefarm-operator/internal/config"
+    "honsefarm-operator/internal/naming"
 )
 
 const (
+    // CoreSecretName is prefixed with spec.namePrefix.
     CoreSecretName = "honsefarm-secrets"
 )
 
-// EnsureCoreSecret ensures a core secret with random credentials exists.
-// It does NOT currently propagate back into spec.global; the operator
-// uses spec.global values as source of truth for config generation.
-func EnsureCoreSecret(ctx context.Context, c client.Client, cluster *v1alpha1.HonseFarmCluster) error {
-    ns := cluster.Spec.Namespace
-    if ns == "" {
-        ns = "honsefarm"
+// Keys of the generated values in CoreSecretName.
+const (
+    JWTSecretKey        = "jwtSecret"
+    DatabasePasswordKey = "databasePassword"
+    RedisPasswordKey    = "redisPassword"
+)
+
+// EnsureCoreSecret ensures a core secret with random credentials exists,
+// adding any key missing from an existing secret, and returns its values.
+// Config generation uses them wherever the matching spec.global credential
+// is left empty.
+func EnsureCoreSecret(ctx context.Context, c client.Client, cluster *v1alpha1.HonseFarmCluster) (cfginternal.Credentials, error) {
+    names := naming.New(cluster)
+    ns := names.Namespace()
+    name := names.Name(CoreSecretName)
+
+    generate := map[string]int{
+        JWTSecretKey:        32,
+        DatabasePasswordKey: 24,
+        RedisPasswordKey:    24,
     }
 
     var sec corev1.Secret
-    err := c.Get(ctx, types.NamespacedName{Name: CoreSecretName, Namespace: ns}, &sec)
-    if err == nil {
-        return nil
-    }
-    if !errors.IsNotFound(err) {
-        return err
+    err := c.Get(ctx, types.NamespacedName{Name: name, Namespace: ns}, &sec)
+    if err != nil && !errors.IsNotFound(err) {
+        return cfginternal.Credentials{}, err
     }
 
-    data := map[string][]byte{
-        "jwtSecret":       randomBytes(32),
-        "databasePassword": randomBytes(24),
-        "redisPassword":   randomBytes(24),
-    }
+    if errors.IsNotFound(err) {
+        data := map[string][]byte{}
+        for key, n := range generate {
+            data[key] = randomBytes(n)
+        }
 
-    sec = corev1.Secret{
-        ObjectMeta: metav1.ObjectMeta{
-            Name:      CoreSecretName,
-            Namespace: ns,
-            Labels: map[string]string{
-                "app.kubernetes.io/managed-by": "honsefarm-operator",
+        sec = corev1.Secret{
+            ObjectMeta: metav1.ObjectMeta{
+                Name:      name,
+                Namespace: ns,
+                Labels: names.WithClusterLabels(map[string]string{
+                    "app.kubernetes.io/managed-by": "honsefarm-operator",
+                }),
             },
-        },
-        Type: corev1.SecretTypeOpaque,
-        Data: data,
+            Type: corev1.SecretTypeOpaque,
+            Data: data,
+        }
+        if err := c.Create(ctx, &sec); err != nil {
+            return cfginternal.Credentials{}, err
+        }
+    } else {
+        // Secrets created before the cluster labels existed are adopted.
+        missing := names.Track(&sec)
+        if sec.Data == nil {
+            sec.Data = map[string][]byte{}
+        }
+        for key, n := range generate {
+            if len(sec.Data[key]) == 0 {
+                sec.Data[key] = randomBytes(n)
+                missing = true
+            }
+        }
+        if missing {
+            if err := c.Update(ctx, &sec); err != nil {
+                return cfginternal.Credentials{}, err
+            }
+        }
     }
 
-    return c.Create(ctx, &sec)
+    return cfginternal.Credentials{
+        JWTSecret:        string(sec.Data[JWTSecretKey]),
+        DatabasePassword: string(sec.Data[DatabasePasswordKey]),
+        RedisPassword:    string(sec.Data[RedisPasswordKey]),
+    }, nil
 }
 
 func randomBytes(n int) []byte {
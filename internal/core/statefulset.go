@@ -0,0 +1,339 @@
+package core
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"sort"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	v1alpha1 "honsefarm-operator/api/v1alpha1"
+	"honsefarm-operator/internal/naming"
+)
+
+// StatefulSetLabel names the StatefulSet a per-replica PVC belongs to.
+const StatefulSetLabel = "honsefarm.io/statefulset"
+
+// dataClaimTemplate is the volumeClaimTemplate of the data volume; cache and
+// cold-storage templates are named after their volumes.
+const dataClaimTemplate = "data"
+
+// ErrLegacyPodsRunning is returned, wrapped, while the pods of the Deployment
+// a fileserver switches away from are still terminating, so its PVCs cannot
+// be cloned yet. Retry shortly; pods are not watched.
+var ErrLegacyPodsRunning = stderrors.New("waiting for the pods of the previous Deployment to terminate")
+
+// StatefulSetPVCName is the PVC the StatefulSet controller creates from a
+// volumeClaimTemplate for the replica with the given ordinal.
+func StatefulSetPVCName(template, statefulSet string, ordinal int32) string {
+	return fmt.Sprintf("%s-%s-%d", template, statefulSet, ordinal)
+}
+
+// claimTemplate is a volumeClaimTemplate of a StatefulSet-mode fileserver.
+type claimTemplate struct {
+	name    string
+	storage *v1alpha1.StorageSpec
+}
+
+// statefulSetClaims lists the volumeClaimTemplates of a fileserver: data when
+// storage is configured, and the pvc-type cache and cold-storage volumes.
+func statefulSetClaims(storage *v1alpha1.StorageSpec, cache, coldStorage *v1alpha1.FileserverVolumeSpec) []claimTemplate {
+	var claims []claimTemplate
+	if storage != nil && storage.Size != "" {
+		claims = append(claims, claimTemplate{name: dataClaimTemplate, storage: storage})
+	}
+	for _, v := range fileserverVolumeList(cache, coldStorage, "", "") {
+		if v.spec != nil && v.spec.PVC != nil && v.spec.PVC.Size != "" {
+			claims = append(claims, claimTemplate{name: v.name, storage: v.spec.PVC})
+		}
+	}
+	return claims
+}
+
+// statefulSetPVCs lists the per-replica PVCs of the replicas a
+// StatefulSet-mode fileserver is configured with.
+func statefulSetPVCs(
+	name string,
+	replicas int32,
+	storage *v1alpha1.StorageSpec,
+	cache, coldStorage *v1alpha1.FileserverVolumeSpec,
+) []WorkloadPVC {
+	var pvcs []WorkloadPVC
+	for ordinal := int32(0); ordinal < replicas; ordinal++ {
+		for _, claim := range statefulSetClaims(storage, cache, coldStorage) {
+			pvcs = append(pvcs, WorkloadPVC{
+				Name:    StatefulSetPVCName(claim.name, name, ordinal),
+				Storage: claim.storage,
+			})
+		}
+	}
+	return pvcs
+}
+
+// ensureFileserverStatefulSet converges a fileserver running with workloadKind
+// StatefulSet. Every replica gets its own data, cache and cold-storage PVCs
+// from volumeClaimTemplates and a stable name under the headless Service.
+//
+// legacyPVCs maps claim template names to the PVCs of the Deployment layout.
+// When the StatefulSet does not exist yet they are cloned into the PVCs of
+// the first replica, so its data survives the switch. The cache is not
+// cloned: it is refilled on demand. The Deployment of the same name is kept
+// scaled to zero, so nothing writes to those PVCs while they are cloned; it
+// is pruned once the StatefulSet is ready.
+func ensureFileserverStatefulSet(
+	ctx context.Context,
+	c client.Client,
+	cluster *v1alpha1.HonseFarmCluster,
+	spec *DeploymentSpec,
+	headless naming.Service,
+	storage *v1alpha1.StorageSpec,
+	cache, coldStorage *v1alpha1.FileserverVolumeSpec,
+	legacyPVCs map[string]string,
+) error {
+	claims := statefulSetClaims(storage, cache, coldStorage)
+
+	var err error
+	spec.Volumes, spec.VolumeMounts, err = ensureFileserverVolumes(ctx, c, cluster, spec.Component, spec.ShardName,
+		cache, coldStorage, "", "", true)
+	if err != nil {
+		return fmt.Errorf("%s volumes: %w", spec.Name, err)
+	}
+	if len(claims) > 0 && claims[0].name == dataClaimTemplate {
+		spec.VolumeMounts = append([]corev1.VolumeMount{{Name: dataClaimTemplate, MountPath: dataDirectory}},
+			spec.VolumeMounts...)
+	}
+	spec.Env = append(spec.Env, corev1.EnvVar{
+		Name: "HONSEFARM_POD_NAME",
+		ValueFrom: &corev1.EnvVarSource{
+			FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.name"},
+		},
+	})
+
+	sts, err := desiredStatefulSet(cluster, spec, headless.Name, claims)
+	if err != nil {
+		return err
+	}
+
+	if err := scaleDownLegacyDeployment(ctx, c, spec.Namespace, spec.Name); err != nil {
+		return fmt.Errorf("scale down deployment %s: %w", spec.Name, err)
+	}
+
+	pvcLabels := componentLabels(spec.Instance, spec.Component, spec.ShardName)
+	pvcLabels[StatefulSetLabel] = spec.Name
+	replicas := spec.Replicas
+
+	var existing appsv1.StatefulSet
+	if err := c.Get(ctx, types.NamespacedName{Name: spec.Name, Namespace: spec.Namespace}, &existing); err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+		if len(claims) > 0 {
+			// The StatefulSet selects the same labels, so any pod left
+			// is one of the Deployment.
+			var pods corev1.PodList
+			if err := c.List(ctx, &pods, client.InNamespace(spec.Namespace),
+				client.MatchingLabels(componentLabels(spec.Instance, spec.Component, spec.ShardName))); err != nil {
+				return err
+			}
+			if len(pods.Items) > 0 {
+				return fmt.Errorf("%s: %w", spec.Name, ErrLegacyPodsRunning)
+			}
+		}
+		for _, claim := range claims {
+			legacy := legacyPVCs[claim.name]
+			if legacy == "" {
+				continue
+			}
+			err := cloneLegacyPVC(ctx, c, cluster, StatefulSetPVCName(claim.name, spec.Name, 0), legacy,
+				claim.storage, pvcLabels)
+			if err != nil {
+				return fmt.Errorf("clone pvc %s: %w", legacy, err)
+			}
+		}
+	} else {
+		if existing.DeletionTimestamp != nil {
+			// Being recreated; the deletion requeues the cluster.
+			return nil
+		}
+		if !sameClaimTemplates(existing.Spec.VolumeClaimTemplates, sts.Spec.VolumeClaimTemplates) {
+			// volumeClaimTemplates are immutable. Orphan the pods so they
+			// keep serving; the deletion requeues the cluster and the
+			// recreated StatefulSet adopts and rolls them.
+			return client.IgnoreNotFound(c.Delete(ctx, &existing,
+				client.PropagationPolicy(metav1.DeletePropagationOrphan)))
+		}
+		// Sizes are converged on the PVCs below instead.
+		sts.Spec.VolumeClaimTemplates = existing.Spec.VolumeClaimTemplates
+		if replicasScaledElsewhere(&existing) {
+			sts.Spec.Replicas = nil
+		}
+		if existing.Spec.Replicas != nil && *existing.Spec.Replicas > replicas {
+			replicas = *existing.Spec.Replicas
+		}
+	}
+
+	// Creating the PVCs up front is harmless, the StatefulSet controller
+	// uses existing claims, and keeps labels, policies and sizes current.
+	for ordinal := int32(0); ordinal < replicas; ordinal++ {
+		for _, claim := range claims {
+			name := StatefulSetPVCName(claim.name, spec.Name, ordinal)
+			if _, err := ensurePVC(ctx, c, cluster, name, claim.storage, pvcLabels); err != nil {
+				return fmt.Errorf("ensure pvc %s: %w", name, err)
+			}
+		}
+	}
+
+	return c.Patch(ctx, sts, client.Apply, client.FieldOwner(FieldOwner), client.ForceOwnership)
+}
+
+// desiredStatefulSet renders the complete StatefulSet for spec.
+func desiredStatefulSet(
+	cluster *v1alpha1.HonseFarmCluster,
+	spec *DeploymentSpec,
+	serviceName string,
+	claims []claimTemplate,
+) (*appsv1.StatefulSet, error) {
+	names := naming.New(cluster)
+	labels := componentLabels(spec.Instance, spec.Component, spec.ShardName)
+	replicas := spec.Replicas
+
+	claimLabels := componentLabels(spec.Instance, spec.Component, spec.ShardName)
+	claimLabels[StatefulSetLabel] = spec.Name
+	var templates []corev1.PersistentVolumeClaim
+	for _, claim := range claims {
+		pvcSpec, err := claimSpec(claim.storage)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", claim.name, err)
+		}
+		templates = append(templates, corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        claim.name,
+				Labels:      names.WithClusterLabels(claimLabels),
+				Annotations: storageAnnotations(claim.storage),
+			},
+			Spec: pvcSpec,
+		})
+	}
+
+	return &appsv1.StatefulSet{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: appsv1.SchemeGroupVersion.String(),
+			Kind:       "StatefulSet",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      spec.Name,
+			Namespace: spec.Namespace,
+			Labels:    names.WithClusterLabels(labels),
+		},
+		Spec: appsv1.StatefulSetSpec{
+			ServiceName: serviceName,
+			Replicas:    &replicas,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labels,
+			},
+			Template:             podTemplate(spec),
+			VolumeClaimTemplates: templates,
+		},
+	}, nil
+}
+
+// sameClaimTemplates reports whether a and b declare the same template names.
+func sameClaimTemplates(a, b []corev1.PersistentVolumeClaim) bool {
+	templateNames := func(claims []corev1.PersistentVolumeClaim) []string {
+		var out []string
+		for _, claim := range claims {
+			out = append(out, claim.Name)
+		}
+		sort.Strings(out)
+		return out
+	}
+	x, y := templateNames(a), templateNames(b)
+	if len(x) != len(y) {
+		return false
+	}
+	for i := range x {
+		if x[i] != y[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// scaleDownLegacyDeployment scales the Deployment name to zero replicas, if it
+// exists.
+func scaleDownLegacyDeployment(ctx context.Context, c client.Client, ns, name string) error {
+	var dep appsv1.Deployment
+	if err := c.Get(ctx, types.NamespacedName{Name: name, Namespace: ns}, &dep); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if dep.DeletionTimestamp != nil || (dep.Spec.Replicas != nil && *dep.Spec.Replicas == 0) {
+		return nil
+	}
+	patch := client.MergeFrom(dep.DeepCopy())
+	zero := int32(0)
+	dep.Spec.Replicas = &zero
+	return c.Patch(ctx, &dep, patch, client.FieldOwner(FieldOwner))
+}
+
+// cloneLegacyPVC creates the PVC name as a clone of the PVC legacy, unless
+// name already exists or there is nothing to clone. Cloning needs a CSI
+// driver with volume cloning support.
+//
+// The clone requests the size of storage, like the PVCs of the other
+// replicas, so it never needs shrinking later. A clone cannot be smaller than
+// its source, so a legacy PVC larger than storage is refused.
+func cloneLegacyPVC(
+	ctx context.Context,
+	c client.Client,
+	cluster *v1alpha1.HonseFarmCluster,
+	name, legacy string,
+	storage *v1alpha1.StorageSpec,
+	podLabels map[string]string,
+) error {
+	ns := naming.New(cluster).Namespace()
+
+	var pvc corev1.PersistentVolumeClaim
+	if err := c.Get(ctx, types.NamespacedName{Name: name, Namespace: ns}, &pvc); err == nil {
+		return nil
+	} else if !errors.IsNotFound(err) {
+		return err
+	}
+	var source corev1.PersistentVolumeClaim
+	if err := c.Get(ctx, types.NamespacedName{Name: legacy, Namespace: ns}, &source); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+
+	// A clone is provisioned in the storage class of its source.
+	claim, err := claimSpec(storage)
+	if err != nil {
+		return err
+	}
+	claim.StorageClassName = source.Spec.StorageClassName
+	if current := source.Spec.Resources.Requests[corev1.ResourceStorage]; current.Cmp(claim.Resources.Requests[corev1.ResourceStorage]) > 0 {
+		return fmt.Errorf("%s is larger than storage.size %s, which must be at least its size",
+			current.String(), storage.Size)
+	}
+	claim.DataSource = &corev1.TypedLocalObjectReference{
+		Kind: "PersistentVolumeClaim",
+		Name: source.Name,
+	}
+
+	labels := naming.New(cluster).WithClusterLabels(podLabels)
+	labels["honsefarm-pvc"] = name
+	pvc = corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   ns,
+			Labels:      labels,
+			Annotations: storageAnnotations(storage),
+		},
+		Spec: claim,
+	}
+	return c.Create(ctx, &pvc)
+}
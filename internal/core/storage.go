@@ -0,0 +1,108 @@
+package core
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	v1alpha1 "honsefarm-operator/api/v1alpha1"
+)
+
+// claimSpec renders the PersistentVolumeClaimSpec requested by storage.
+func claimSpec(storage *v1alpha1.StorageSpec) (corev1.PersistentVolumeClaimSpec, error) {
+	size, err := resource.ParseQuantity(storage.Size)
+	if err != nil {
+		return corev1.PersistentVolumeClaimSpec{}, fmt.Errorf("invalid storage size %q: %w", storage.Size, err)
+	}
+	spec := corev1.PersistentVolumeClaimSpec{
+		Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{
+				corev1.ResourceStorage: size,
+			},
+		},
+	}
+
+	// AccessModes
+	for _, m := range storage.AccessModes {
+		spec.AccessModes = append(spec.AccessModes, corev1.PersistentVolumeAccessMode(m))
+	}
+
+	// StorageClass
+	if storage.StorageClassName != "" {
+		className := storage.StorageClassName
+		spec.StorageClassName = &className
+	}
+
+	return spec, nil
+}
+
+// ResizeBlocker explains why pvc cannot be converged to storage: the size is
+// invalid or smaller than the current request, the storage class differs, or
+// the storage class does not allow volume expansion. It returns an empty
+// reason when the PVC already matches or can be expanded in place.
+func ResizeBlocker(
+	ctx context.Context,
+	c client.Reader,
+	storage *v1alpha1.StorageSpec,
+	pvc *corev1.PersistentVolumeClaim,
+) (reason, message string, err error) {
+	size, err := resource.ParseQuantity(storage.Size)
+	if err != nil {
+		return "InvalidSize", fmt.Sprintf("%s: invalid storage.size %q: %v", pvc.Name, storage.Size, err), nil
+	}
+
+	class := ""
+	if pvc.Spec.StorageClassName != nil {
+		class = *pvc.Spec.StorageClassName
+	}
+	if storage.StorageClassName != "" && storage.StorageClassName != class {
+		return "StorageClassChangeNotSupported", fmt.Sprintf("%s: storageClassName cannot be changed from %q to %q",
+			pvc.Name, class, storage.StorageClassName), nil
+	}
+
+	current := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+	switch size.Cmp(current) {
+	case 0:
+		return "", "", nil
+	case -1:
+		return "ShrinkNotSupported", fmt.Sprintf("%s: cannot shrink from %s to %s",
+			pvc.Name, current.String(), size.String()), nil
+	}
+
+	if class == "" {
+		return "ExpansionNotSupported", fmt.Sprintf("%s: cannot expand a PVC without a storage class", pvc.Name), nil
+	}
+	var sc storagev1.StorageClass
+	if err := c.Get(ctx, types.NamespacedName{Name: class}, &sc); err != nil {
+		if errors.IsNotFound(err) {
+			return "ExpansionNotSupported", fmt.Sprintf("%s: storage class %q not found", pvc.Name, class), nil
+		}
+		return "", "", err
+	}
+	if sc.AllowVolumeExpansion == nil || !*sc.AllowVolumeExpansion {
+		return "ExpansionNotSupported", fmt.Sprintf("%s: storage class %q does not allow volume expansion",
+			pvc.Name, class), nil
+	}
+	return "", "", nil
+}
+
+// ResizeProgress returns the condition type and message of an expansion
+// that is still in progress on pvc, or empty strings.
+func ResizeProgress(pvc *corev1.PersistentVolumeClaim) (string, string) {
+	for _, cond := range pvc.Status.Conditions {
+		if cond.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch cond.Type {
+		case corev1.PersistentVolumeClaimResizing, corev1.PersistentVolumeClaimFileSystemResizePending:
+			return string(cond.Type), cond.Message
+		}
+	}
+	return "", ""
+}
@@ -0,0 +1,90 @@
+package core
+
+import (
+	"fmt"
+	"slices"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	v1alpha1 "honsefarm-operator/api/v1alpha1"
+)
+
+// readWriteOnce reports whether the data PVC (storage) or one of the
+// additional PVCs of a Deployment can only be mounted read-write by one node
+// at a time. AccessModes default to ReadWriteOnce.
+func readWriteOnce(storage *v1alpha1.StorageSpec, additional []WorkloadPVC) bool {
+	storages := []*v1alpha1.StorageSpec{storage}
+	for _, extra := range additional {
+		storages = append(storages, extra.Storage)
+	}
+	for _, s := range storages {
+		if s == nil || s.Size == "" {
+			continue
+		}
+		if !slices.Contains(s.AccessModes, string(corev1.ReadWriteMany)) {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadWriteOnce reports whether w is a Deployment whose pods share a
+// ReadWriteOnce PVC, so no two of them can run at the same time.
+func (w Workload) ReadWriteOnce() bool {
+	return w.Kind != v1alpha1.WorkloadKindStatefulSet && readWriteOnce(w.Storage, w.AdditionalPVCs)
+}
+
+// ReplicaConflicts lists the workloads of cluster that ask for more than one
+// replica of a Deployment sharing a ReadWriteOnce PVC. Their second pod could
+// never start.
+func ReplicaConflicts(cluster *v1alpha1.HonseFarmCluster) []string {
+	var conflicts []string
+	for _, w := range Workloads(cluster) {
+		if w.Replicas > 1 && w.ReadWriteOnce() {
+			conflicts = append(conflicts, fmt.Sprintf(
+				"%s: %d replicas cannot share a ReadWriteOnce PVC; use accessModes [ReadWriteMany], "+
+					"workloadKind StatefulSet or a single replica", w.DeploymentName, w.Replicas))
+		}
+	}
+	return conflicts
+}
+
+// replicasFor is the replica count of a workload: the configured one, else
+// the sizing preset, else 1. The preset is not applied to a Deployment on a
+// ReadWriteOnce PVC, whose second pod could never start.
+func replicasFor(explicit *int32, preset int32, rwo bool) int32 {
+	switch {
+	case explicit != nil:
+		return *explicit
+	case preset > 0 && !rwo:
+		return preset
+	default:
+		return v1alpha1.DefaultReplicas
+	}
+}
+
+// deploymentStrategy renders spec. Without an explicit type, Deployments on a
+// ReadWriteOnce PVC are recreated: a surge pod would wait for the volume the
+// old pod holds and the rollout would never finish.
+func deploymentStrategy(spec *v1alpha1.DeploymentStrategySpec, rwo bool) appsv1.DeploymentStrategy {
+	strategyType := v1alpha1.StrategyRollingUpdate
+	if rwo {
+		strategyType = v1alpha1.StrategyRecreate
+	}
+	if spec != nil && spec.Type != "" {
+		strategyType = spec.Type
+	}
+
+	if strategyType == v1alpha1.StrategyRecreate {
+		return appsv1.DeploymentStrategy{Type: appsv1.RecreateDeploymentStrategyType}
+	}
+	strategy := appsv1.DeploymentStrategy{Type: appsv1.RollingUpdateDeploymentStrategyType}
+	if spec != nil && (spec.MaxSurge != nil || spec.MaxUnavailable != nil) {
+		strategy.RollingUpdate = &appsv1.RollingUpdateDeployment{
+			MaxSurge:       spec.MaxSurge,
+			MaxUnavailable: spec.MaxUnavailable,
+		}
+	}
+	return strategy
+}
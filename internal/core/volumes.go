@@ -0,0 +1,142 @@
+package core
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	v1alpha1 "honsefarm-operator/api/v1alpha1"
+	cfginternal "honsefarm-operator/internal/config"
+	"honsefarm-operator/internal/naming"
+)
+
+// Names of the PVCs backing fileserver cache and cold-storage volumes of
+// type pvc, before the spec.namePrefix.
+const (
+	MainFileserverCachePVCName       = "main-fileserver-cache"
+	MainFileserverColdStoragePVCName = "main-fileserver-coldstorage"
+)
+
+// Names of the fileserver cache and cold-storage volumes, which also name
+// their volumeClaimTemplates in StatefulSet mode.
+const (
+	cacheVolume       = "cache"
+	coldStorageVolume = "coldstorage"
+)
+
+func ShardCachePVCName(shard string) string {
+	return fmt.Sprintf("shard-%s-cache", shard)
+}
+
+func ShardColdStoragePVCName(shard string) string {
+	return fmt.Sprintf("shard-%s-coldstorage", shard)
+}
+
+// WorkloadPVC is a PVC of a workload besides its data PVC.
+type WorkloadPVC struct {
+	Name    string
+	Storage *v1alpha1.StorageSpec
+}
+
+// fileserverVolume is a cache or cold-storage volume of a fileserver.
+type fileserverVolume struct {
+	name      string
+	mountPath string
+	pvcName   string
+	spec      *v1alpha1.FileserverVolumeSpec
+}
+
+func fileserverVolumeList(cache, coldStorage *v1alpha1.FileserverVolumeSpec, cachePVC, coldStoragePVC string) []fileserverVolume {
+	return []fileserverVolume{
+		{name: cacheVolume, mountPath: cfginternal.CacheDirectory, pvcName: cachePVC, spec: cache},
+		{name: coldStorageVolume, mountPath: cfginternal.ColdStorageDirectory, pvcName: coldStoragePVC, spec: coldStorage},
+	}
+}
+
+// fileserverPVCs lists the PVCs behind the pvc-type cache and cold-storage
+// volumes.
+func fileserverPVCs(cache, coldStorage *v1alpha1.FileserverVolumeSpec, cachePVC, coldStoragePVC string) []WorkloadPVC {
+	var pvcs []WorkloadPVC
+	for _, v := range fileserverVolumeList(cache, coldStorage, cachePVC, coldStoragePVC) {
+		if v.spec != nil && v.spec.PVC != nil && v.spec.PVC.Size != "" {
+			pvcs = append(pvcs, WorkloadPVC{Name: v.pvcName, Storage: v.spec.PVC})
+		}
+	}
+	return pvcs
+}
+
+// ensureFileserverVolumes ensures the PVCs behind a fileserver's cache and
+// cold-storage volumes and returns the pod volumes and container mounts.
+// With perReplica, pvc-type volumes come from StatefulSet
+// volumeClaimTemplates: only their mounts are returned.
+func ensureFileserverVolumes(
+	ctx context.Context,
+	c client.Client,
+	cluster *v1alpha1.HonseFarmCluster,
+	component, shardName string,
+	cache, coldStorage *v1alpha1.FileserverVolumeSpec,
+	cachePVC, coldStoragePVC string,
+	perReplica bool,
+) ([]corev1.Volume, []corev1.VolumeMount, error) {
+	var volumes []corev1.Volume
+	var mounts []corev1.VolumeMount
+
+	for _, v := range fileserverVolumeList(cache, coldStorage, cachePVC, coldStoragePVC) {
+		if v.spec == nil {
+			continue
+		}
+
+		mount := corev1.VolumeMount{Name: v.name, MountPath: v.mountPath}
+
+		var source corev1.VolumeSource
+		switch {
+		case v.spec.PVC != nil:
+			if v.spec.PVC.Size == "" {
+				return nil, nil, fmt.Errorf("%s: pvc.size must be set", v.name)
+			}
+			if perReplica {
+				mounts = append(mounts, mount)
+				continue
+			}
+			pvc, err := ensurePVC(ctx, c, cluster, v.pvcName, v.spec.PVC, componentLabels(naming.New(cluster).Prefix(), component, shardName))
+			if err != nil {
+				return nil, nil, fmt.Errorf("ensure %s pvc: %w", v.name, err)
+			}
+			source.PersistentVolumeClaim = &corev1.PersistentVolumeClaimVolumeSource{ClaimName: pvc.Name}
+		case v.spec.EmptyDir != nil:
+			source.EmptyDir = &corev1.EmptyDirVolumeSource{
+				Medium: corev1.StorageMedium(v.spec.EmptyDir.Medium),
+			}
+			if v.spec.EmptyDir.SizeLimit != "" {
+				limit, err := resource.ParseQuantity(v.spec.EmptyDir.SizeLimit)
+				if err != nil {
+					return nil, nil, fmt.Errorf("%s: invalid emptyDir.sizeLimit: %w", v.name, err)
+				}
+				source.EmptyDir.SizeLimit = &limit
+			}
+		case v.spec.Ephemeral != nil:
+			if v.spec.Ephemeral.Size == "" {
+				return nil, nil, fmt.Errorf("%s: ephemeral.size must be set", v.name)
+			}
+			claim, err := claimSpec(v.spec.Ephemeral)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", v.name, err)
+			}
+			source.Ephemeral = &corev1.EphemeralVolumeSource{
+				VolumeClaimTemplate: &corev1.PersistentVolumeClaimTemplate{
+					Spec: claim,
+				},
+			}
+		default:
+			return nil, nil, fmt.Errorf("%s: one of pvc, emptyDir or ephemeral must be set", v.name)
+		}
+
+		volumes = append(volumes, corev1.Volume{Name: v.name, VolumeSource: source})
+		mounts = append(mounts, mount)
+	}
+
+	return volumes, mounts, nil
+}
@@ -2,34 +2,201 @@ package core
 
 import (
 	"context"
+	"encoding/json"
+	stderrors "errors"
 	"fmt"
+	"path"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
-	ctrl "sigs.k8s.io/controller-runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/util/csaupgrade"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	v1alpha1 "honsefarm-operator/api/v1alpha1"
+	cfginternal "honsefarm-operator/internal/config"
+	"honsefarm-operator/internal/naming"
+	"honsefarm-operator/internal/sizing"
 )
 
-func namespaceFor(cluster *v1alpha1.HonseFarmCluster) string {
-	if cluster.Spec.Namespace != "" {
-		return cluster.Spec.Namespace
+// Component identifiers, used as the honsefarm-component label value.
+const (
+	ComponentServer          = "server"
+	ComponentAdminPanel      = "adminpanel"
+	ComponentMainFileserver  = "main-fileserver"
+	ComponentShardFileserver = "shard-fileserver"
+)
+
+// Names of the per-component Deployments and data PVCs. Like every object
+// name, they are prefixed with spec.namePrefix through naming.Names.Name.
+const (
+	ServerDeploymentName         = "honsefarm-server"
+	AdminPanelDeploymentName     = "honsefarm-adminpanel"
+	MainFileserverDeploymentName = "honsefarm-main-fileserver"
+
+	ServerPVCName         = "server-data"
+	AdminPanelPVCName     = "adminpanel-data"
+	MainFileserverPVCName = "main-fileserver-data"
+)
+
+func ShardDeploymentName(shard string) string {
+	return fmt.Sprintf("honsefarm-shard-%s", shard)
+}
+
+func ShardPVCName(shard string) string {
+	return fmt.Sprintf("shard-%s-data", shard)
+}
+
+// Workload identifies a Deployment (or StatefulSet), and its data PVC when
+// storage is configured, that the operator manages for a cluster.
+type Workload struct {
+	Component string
+	ShardName string
+	// Kind is v1alpha1.WorkloadKindDeployment or WorkloadKindStatefulSet.
+	Kind           string
+	DeploymentName string
+	// Replicas is the configured replica count.
+	Replicas int32
+	// PVCName is the data PVC of the Deployment layout; StatefulSet replica
+	// PVCs are listed in AdditionalPVCs.
+	PVCName string
+	// Storage is the spec of the data PVC, nil without one.
+	Storage *v1alpha1.StorageSpec
+	// AdditionalPVCs are the PVCs of pvc-type cache and cold-storage
+	// volumes.
+	AdditionalPVCs []WorkloadPVC
+	// LegacyPVCNames are the PVCs of the Deployment layout a StatefulSet
+	// workload was migrated from. They are kept until the StatefulSet is
+	// ready.
+	LegacyPVCNames []string
+}
+
+// Service returns the Service fronting w.
+func (w Workload) Service(names naming.Names) naming.Service {
+	switch w.Component {
+	case ComponentServer:
+		return names.ServerService()
+	case ComponentAdminPanel:
+		return names.AdminPanelService()
+	case ComponentMainFileserver:
+		return names.MainFileserverService()
+	default:
+		return names.ShardService(w.ShardName)
 	}
-	return "honsefarm"
+}
+
+// Workloads lists the workloads requested by the cluster spec.
+func Workloads(cluster *v1alpha1.HonseFarmCluster) []Workload {
+	comps := cluster.Spec.Components
+	if comps == nil {
+		return nil
+	}
+
+	pvcName := func(storage *v1alpha1.StorageSpec, name string) string {
+		if storage != nil && storage.Size != "" {
+			return name
+		}
+		return ""
+	}
+	storage := func(storage *v1alpha1.StorageSpec) *v1alpha1.StorageSpec {
+		if storage != nil && storage.Size != "" {
+			return storage
+		}
+		return nil
+	}
+
+	profile := sizing.Of(cluster)
+	names := naming.New(cluster)
+
+	var workloads []Workload
+	if comps.Server != nil {
+		w := Workload{
+			Component:      ComponentServer,
+			Kind:           v1alpha1.WorkloadKindDeployment,
+			DeploymentName: names.Name(ServerDeploymentName),
+			PVCName:        pvcName(comps.Server.Storage, names.Name(ServerPVCName)),
+			Storage:        storage(comps.Server.Storage),
+		}
+		w.Replicas = replicasFor(comps.Server.Replicas, profile.Server.Replicas, w.ReadWriteOnce())
+		workloads = append(workloads, w)
+	}
+	if comps.AdminPanel != nil {
+		w := Workload{
+			Component:      ComponentAdminPanel,
+			Kind:           v1alpha1.WorkloadKindDeployment,
+			DeploymentName: names.Name(AdminPanelDeploymentName),
+			PVCName:        pvcName(comps.AdminPanel.Storage, names.Name(AdminPanelPVCName)),
+			Storage:        storage(comps.AdminPanel.Storage),
+		}
+		w.Replicas = replicasFor(comps.AdminPanel.Replicas, profile.AdminPanel.Replicas, w.ReadWriteOnce())
+		workloads = append(workloads, w)
+	}
+	if comps.Fileservers != nil {
+		if main := comps.Fileservers.Main; main != nil {
+			w := Workload{
+				Component:      ComponentMainFileserver,
+				Kind:           v1alpha1.WorkloadKindDeployment,
+				DeploymentName: names.Name(MainFileserverDeploymentName),
+				PVCName:        pvcName(main.Storage, names.Name(MainFileserverPVCName)),
+				Storage:        storage(main.Storage),
+				AdditionalPVCs: fileserverPVCs(main.Cache, main.ColdStorage,
+					names.Name(MainFileserverCachePVCName), names.Name(MainFileserverColdStoragePVCName)),
+			}
+			if main.WorkloadKind == v1alpha1.WorkloadKindStatefulSet {
+				w.Kind = v1alpha1.WorkloadKindStatefulSet
+				w.PVCName, w.Storage, w.AdditionalPVCs = "", nil, nil
+			}
+			w.Replicas = replicasFor(main.Replicas, profile.MainFileserver.Replicas, w.ReadWriteOnce())
+			if w.Kind == v1alpha1.WorkloadKindStatefulSet {
+				w.AdditionalPVCs = statefulSetPVCs(w.DeploymentName, w.Replicas, main.Storage, main.Cache, main.ColdStorage)
+				w.LegacyPVCNames = []string{
+					names.Name(MainFileserverPVCName),
+					names.Name(MainFileserverCachePVCName),
+					names.Name(MainFileserverColdStoragePVCName),
+				}
+			}
+			workloads = append(workloads, w)
+		}
+		for _, shard := range comps.Fileservers.Shards {
+			w := Workload{
+				Component:      ComponentShardFileserver,
+				ShardName:      shard.Name,
+				Kind:           v1alpha1.WorkloadKindDeployment,
+				DeploymentName: names.Name(ShardDeploymentName(shard.Name)),
+				PVCName:        pvcName(shard.Storage, names.Name(ShardPVCName(shard.Name))),
+				Storage:        storage(shard.Storage),
+				AdditionalPVCs: fileserverPVCs(shard.Cache, shard.ColdStorage,
+					names.Name(ShardCachePVCName(shard.Name)), names.Name(ShardColdStoragePVCName(shard.Name))),
+			}
+			if shard.WorkloadKind == v1alpha1.WorkloadKindStatefulSet {
+				w.Kind = v1alpha1.WorkloadKindStatefulSet
+				w.PVCName, w.Storage, w.AdditionalPVCs = "", nil, nil
+			}
+			w.Replicas = replicasFor(shard.Replicas, profile.ShardFileserver.Replicas, w.ReadWriteOnce())
+			if w.Kind == v1alpha1.WorkloadKindStatefulSet {
+				w.AdditionalPVCs = statefulSetPVCs(w.DeploymentName, w.Replicas, shard.Storage, shard.Cache, shard.ColdStorage)
+				w.LegacyPVCNames = []string{
+					names.Name(ShardPVCName(shard.Name)),
+					names.Name(ShardCachePVCName(shard.Name)),
+					names.Name(ShardColdStoragePVCName(shard.Name)),
+				}
+			}
+			workloads = append(workloads, w)
+		}
+	}
+	return workloads
 }
 
 // EnsureServerWorkload creates/updates PVC + Deployment for the core server.
 func EnsureServerWorkload(
 	ctx context.Context,
 	c client.Client,
-	scheme *runtime.Scheme,
 	cluster *v1alpha1.HonseFarmCluster,
+	bundle *cfginternal.Bundle,
 ) error {
 	if cluster.Spec.Components == nil || cluster.Spec.Components.Server == nil {
 		// server disabled
@@ -39,24 +206,24 @@ func EnsureServerWorkload(
 		return fmt.Errorf("spec.images.server must be set")
 	}
 
-	ns := namespaceFor(cluster)
+	names := naming.New(cluster)
 	comp := cluster.Spec.Components.Server
 
 	// PVC (optional)
 	var pvc *corev1.PersistentVolumeClaim
 	var err error
 	if comp.Storage != nil && comp.Storage.Size != "" {
-		pvc, err = ensurePVC(ctx, c, scheme, cluster, "server-data", comp.Storage)
+		pvc, err = ensurePVC(ctx, c, cluster, names.Name(ServerPVCName), comp.Storage,
+			componentLabels(names.Prefix(), ComponentServer, ""))
 		if err != nil {
 			return fmt.Errorf("ensure server pvc: %w", err)
 		}
 	}
 
 	// Deployment
-	replicas := int32(1)
-	if comp.Replicas != nil {
-		replicas = *comp.Replicas
-	}
+	preset := sizing.Of(cluster).Server
+	rwo := readWriteOnce(comp.Storage, nil)
+	replicas := replicasFor(comp.Replicas, preset.Replicas, rwo)
 
 	env := []corev1.EnvVar{
 		{
@@ -64,17 +231,24 @@ func EnsureServerWorkload(
 			Value: "Production",
 		},
 	}
-
-	return ensureDeployment(ctx, c, scheme, cluster, &DeploymentSpec{
-		Name:            "honsefarm-server",
-		Namespace:       ns,
-		Component:       "server",
-		Image:           cluster.Spec.Images.Server,
-		Replicas:        replicas,
-		ContainerPort:   5000,
-		ConfigMountPath: "/app/config",
-		PVC:             pvc,
-		Env:             env,
+	env = append(env, bundle.SecretEnv(cfginternal.ServerComponent)...)
+
+	return ensureDeployment(ctx, c, cluster, &DeploymentSpec{
+		Name:           names.Name(ServerDeploymentName),
+		Namespace:      names.Namespace(),
+		Instance:       names.Prefix(),
+		Component:      ComponentServer,
+		Image:          cluster.Spec.Images.Server,
+		Replicas:       replicas,
+		Strategy:       deploymentStrategy(comp.Strategy, rwo),
+		Resources:      sizing.Resources(preset.Resources, comp.Resources),
+		Scheduling:     &comp.SchedulingSpec,
+		ContainerPort:  comp.Port,
+		ConfigMapName:  bundle.ConfigMap.Name,
+		ConfigKey:      cfginternal.AppSettingsKey(cfginternal.ServerComponent),
+		ConfigChecksum: bundle.Checksum(cfginternal.ServerComponent),
+		PVC:            pvc,
+		Env:            env,
 	})
 }
 
@@ -82,8 +256,8 @@ func EnsureServerWorkload(
 func EnsureAdminWorkload(
 	ctx context.Context,
 	c client.Client,
-	scheme *runtime.Scheme,
 	cluster *v1alpha1.HonseFarmCluster,
+	bundle *cfginternal.Bundle,
 ) error {
 	if cluster.Spec.Components == nil || cluster.Spec.Components.AdminPanel == nil {
 		// admin panel disabled
@@ -93,22 +267,22 @@ func EnsureAdminWorkload(
 		return fmt.Errorf("spec.images.adminPanel must be set")
 	}
 
-	ns := namespaceFor(cluster)
+	names := naming.New(cluster)
 	comp := cluster.Spec.Components.AdminPanel
 
 	var pvc *corev1.PersistentVolumeClaim
 	var err error
 	if comp.Storage != nil && comp.Storage.Size != "" {
-		pvc, err = ensurePVC(ctx, c, scheme, cluster, "adminpanel-data", comp.Storage)
+		pvc, err = ensurePVC(ctx, c, cluster, names.Name(AdminPanelPVCName), comp.Storage,
+			componentLabels(names.Prefix(), ComponentAdminPanel, ""))
 		if err != nil {
 			return fmt.Errorf("ensure adminpanel pvc: %w", err)
 		}
 	}
 
-	replicas := int32(1)
-	if comp.Replicas != nil {
-		replicas = *comp.Replicas
-	}
+	preset := sizing.Of(cluster).AdminPanel
+	rwo := readWriteOnce(comp.Storage, nil)
+	replicas := replicasFor(comp.Replicas, preset.Replicas, rwo)
 
 	env := []corev1.EnvVar{
 		{
@@ -116,17 +290,25 @@ func EnsureAdminWorkload(
 			Value: "Production",
 		},
 	}
-
-	return ensureDeployment(ctx, c, scheme, cluster, &DeploymentSpec{
-		Name:            "honsefarm-adminpanel",
-		Namespace:       ns,
-		Component:       "adminpanel",
-		Image:           cluster.Spec.Images.AdminPanel,
-		Replicas:        replicas,
-		ContainerPort:   5000,
-		ConfigMountPath: "/app/config",
-		PVC:             pvc,
-		Env:             env,
+	env = append(env, bundle.SecretEnv(cfginternal.AdminPanelComponent)...)
+
+	return ensureDeployment(ctx, c, cluster, &DeploymentSpec{
+		Name:           names.Name(AdminPanelDeploymentName),
+		Namespace:      names.Namespace(),
+		Instance:       names.Prefix(),
+		Component:      ComponentAdminPanel,
+		Image:          cluster.Spec.Images.AdminPanel,
+		Replicas:       replicas,
+		Strategy:       deploymentStrategy(comp.Strategy, rwo),
+		Resources:      sizing.Resources(preset.Resources, comp.Resources),
+		Scheduling:     &comp.SchedulingSpec,
+		ContainerPort:  comp.Port,
+		ConfigMapName:  bundle.ConfigMap.Name,
+		ConfigKey:      cfginternal.AppSettingsKey(cfginternal.AdminPanelComponent),
+		ConfigFilesDir: cfginternal.ConfigFilesDir,
+		ConfigChecksum: bundle.Checksum(cfginternal.AdminPanelComponent),
+		PVC:            pvc,
+		Env:            env,
 	})
 }
 
@@ -134,8 +316,8 @@ func EnsureAdminWorkload(
 func EnsureMainFileserverWorkload(
 	ctx context.Context,
 	c client.Client,
-	scheme *runtime.Scheme,
 	cluster *v1alpha1.HonseFarmCluster,
+	bundle *cfginternal.Bundle,
 ) error {
 	if cluster.Spec.Components == nil ||
 		cluster.Spec.Components.Fileservers == nil ||
@@ -147,76 +329,97 @@ func EnsureMainFileserverWorkload(
 		return fmt.Errorf("spec.images.mainFileserver must be set")
 	}
 
-	ns := namespaceFor(cluster)
+	names := naming.New(cluster)
 	comp := cluster.Spec.Components.Fileservers.Main
+	cachePVC := names.Name(MainFileserverCachePVCName)
+	coldStoragePVC := names.Name(MainFileserverColdStoragePVCName)
+
+	preset := sizing.Of(cluster).MainFileserver
+	// Per-replica PVCs of a StatefulSet are never shared.
+	rwo := comp.WorkloadKind != v1alpha1.WorkloadKindStatefulSet && readWriteOnce(comp.Storage,
+		fileserverPVCs(comp.Cache, comp.ColdStorage, cachePVC, coldStoragePVC))
+	replicas := replicasFor(comp.Replicas, preset.Replicas, rwo)
+
+	env := []corev1.EnvVar{
+		{
+			Name:  "ASPNETCORE_ENVIRONMENT",
+			Value: "Production",
+		},
+	}
+	env = append(env, bundle.SecretEnv(cfginternal.MainFileserverComponent)...)
+
+	spec := &DeploymentSpec{
+		Name:           names.Name(MainFileserverDeploymentName),
+		Namespace:      names.Namespace(),
+		Instance:       names.Prefix(),
+		Component:      ComponentMainFileserver,
+		Image:          cluster.Spec.Images.MainFileserver,
+		Replicas:       replicas,
+		Strategy:       deploymentStrategy(comp.Strategy, rwo),
+		Resources:      sizing.Resources(preset.Resources, comp.Resources),
+		Scheduling:     &comp.SchedulingSpec,
+		ContainerPort:  comp.Port,
+		ConfigMapName:  bundle.ConfigMap.Name,
+		ConfigKey:      cfginternal.AppSettingsKey(cfginternal.MainFileserverComponent),
+		ConfigChecksum: bundle.Checksum(cfginternal.MainFileserverComponent),
+		Env:            env,
+	}
+
+	if comp.WorkloadKind == v1alpha1.WorkloadKindStatefulSet {
+		return ensureFileserverStatefulSet(ctx, c, cluster, spec,
+			names.MainFileserverService().Headless(),
+			comp.Storage, comp.Cache, comp.ColdStorage, map[string]string{
+				dataClaimTemplate: names.Name(MainFileserverPVCName),
+				coldStorageVolume: coldStoragePVC,
+			})
+	}
 
-	var pvc *corev1.PersistentVolumeClaim
 	var err error
 	if comp.Storage != nil && comp.Storage.Size != "" {
-		pvc, err = ensurePVC(ctx, c, scheme, cluster, "main-fileserver-data", comp.Storage)
+		spec.PVC, err = ensurePVC(ctx, c, cluster, names.Name(MainFileserverPVCName), comp.Storage,
+			componentLabels(names.Prefix(), ComponentMainFileserver, ""))
 		if err != nil {
 			return fmt.Errorf("ensure main-fileserver pvc: %w", err)
 		}
 	}
 
-	replicas := int32(1)
-	if comp.Replicas != nil {
-		replicas = *comp.Replicas
+	spec.Volumes, spec.VolumeMounts, err = ensureFileserverVolumes(ctx, c, cluster, ComponentMainFileserver, "",
+		comp.Cache, comp.ColdStorage, cachePVC, coldStoragePVC, false)
+	if err != nil {
+		return fmt.Errorf("main-fileserver volumes: %w", err)
 	}
 
-	env := []corev1.EnvVar{
-		{
-			Name:  "ASPNETCORE_ENVIRONMENT",
-			Value: "Production",
-		},
-	}
-
-	return ensureDeployment(ctx, c, scheme, cluster, &DeploymentSpec{
-		Name:            "honsefarm-main-fileserver",
-		Namespace:       ns,
-		Component:       "main-fileserver",
-		Image:           cluster.Spec.Images.MainFileserver,
-		Replicas:        replicas,
-		ContainerPort:   5001,
-		ConfigMountPath: "/app/config",
-		PVC:             pvc,
-		Env:             env,
-	})
+	return ensureDeployment(ctx, c, cluster, spec)
 }
 
 // EnsureShardWorkloads creates/updates PVCs + Deployments for all configured shards.
 func EnsureShardWorkloads(
 	ctx context.Context,
 	c client.Client,
-	scheme *runtime.Scheme,
 	cluster *v1alpha1.HonseFarmCluster,
+	bundle *cfginternal.Bundle,
 ) error {
 	if cluster.Spec.Components == nil ||
-		cluster.Spec.Components.Fileservers == nil {
+		cluster.Spec.Components.Fileservers == nil ||
+		len(cluster.Spec.Components.Fileservers.Shards) == 0 {
 		return nil
 	}
 	if cluster.Spec.Images == nil || cluster.Spec.Images.ShardFileserver == "" {
 		return fmt.Errorf("spec.images.shardFileserver must be set")
 	}
 
-	ns := namespaceFor(cluster)
+	names := naming.New(cluster)
+	preset := sizing.Of(cluster).ShardFileserver
 
+	// A shard waiting for its previous Deployment does not hold back the
+	// others.
+	var waiting error
 	for _, shard := range cluster.Spec.Components.Fileservers.Shards {
-		// Each shard gets its own PVC + Deployment
-		var pvc *corev1.PersistentVolumeClaim
-		var err error
-		if shard.Storage != nil && shard.Storage.Size != "" {
-			pvcName := fmt.Sprintf("shard-%s-data", shard.Name)
-			pvc, err = ensurePVC(ctx, c, scheme, cluster, pvcName, shard.Storage)
-			if err != nil {
-				return fmt.Errorf("ensure shard pvc %s: %w", shard.Name, err)
-			}
-		}
-
-		replicas := int32(1)
-		if shard.Replicas != nil {
-			replicas = *shard.Replicas
-		}
+		cachePVC := names.Name(ShardCachePVCName(shard.Name))
+		coldStoragePVC := names.Name(ShardColdStoragePVCName(shard.Name))
+		rwo := shard.WorkloadKind != v1alpha1.WorkloadKindStatefulSet && readWriteOnce(shard.Storage,
+			fileserverPVCs(shard.Cache, shard.ColdStorage, cachePVC, coldStoragePVC))
+		replicas := replicasFor(shard.Replicas, preset.Replicas, rwo)
 
 		env := []corev1.EnvVar{
 			{
@@ -228,242 +431,483 @@ func EnsureShardWorkloads(
 				Value: shard.Name,
 			},
 		}
+		env = append(env, bundle.SecretEnv(cfginternal.ShardComponent(shard.Name))...)
+
+		spec := &DeploymentSpec{
+			Name:           names.Name(ShardDeploymentName(shard.Name)),
+			Namespace:      names.Namespace(),
+			Instance:       names.Prefix(),
+			Component:      ComponentShardFileserver,
+			ShardName:      shard.Name,
+			Image:          cluster.Spec.Images.ShardFileserver,
+			Replicas:       replicas,
+			Strategy:       deploymentStrategy(shard.Strategy, rwo),
+			Resources:      sizing.Resources(preset.Resources, shard.Resources),
+			Scheduling:     &shard.SchedulingSpec,
+			ContainerPort:  shard.Port,
+			ConfigMapName:  bundle.ConfigMap.Name,
+			ConfigKey:      cfginternal.AppSettingsKey(cfginternal.ShardComponent(shard.Name)),
+			ConfigChecksum: bundle.Checksum(cfginternal.ShardComponent(shard.Name)),
+			Env:            env,
+		}
+
+		if shard.WorkloadKind == v1alpha1.WorkloadKindStatefulSet {
+			if err := ensureFileserverStatefulSet(ctx, c, cluster, spec,
+				names.ShardService(shard.Name).Headless(),
+				shard.Storage, shard.Cache, shard.ColdStorage, map[string]string{
+					dataClaimTemplate: names.Name(ShardPVCName(shard.Name)),
+					coldStorageVolume: coldStoragePVC,
+				}); stderrors.Is(err, ErrLegacyPodsRunning) {
+				waiting = err
+			} else if err != nil {
+				return fmt.Errorf("ensure shard statefulset %s: %w", shard.Name, err)
+			}
+			continue
+		}
+
+		// Each shard gets its own PVC + Deployment
+		var err error
+		if shard.Storage != nil && shard.Storage.Size != "" {
+			spec.PVC, err = ensurePVC(ctx, c, cluster, names.Name(ShardPVCName(shard.Name)), shard.Storage,
+				componentLabels(names.Prefix(), ComponentShardFileserver, shard.Name))
+			if err != nil {
+				return fmt.Errorf("ensure shard pvc %s: %w", shard.Name, err)
+			}
+		}
 
-		depName := fmt.Sprintf("honsefarm-shard-%s", shard.Name)
-
-		if err := ensureDeployment(ctx, c, scheme, cluster, &DeploymentSpec{
-			Name:            depName,
-			Namespace:       ns,
-			Component:       "shard-fileserver",
-			ShardName:       shard.Name,
-			Image:           cluster.Spec.Images.ShardFileserver,
-			Replicas:        replicas,
-			ContainerPort:   5002,
-			ConfigMountPath: "/app/config",
-			PVC:             pvc,
-			Env:             env,
-		}); err != nil {
+		spec.Volumes, spec.VolumeMounts, err = ensureFileserverVolumes(ctx, c, cluster, ComponentShardFileserver, shard.Name,
+			shard.Cache, shard.ColdStorage, cachePVC, coldStoragePVC, false)
+		if err != nil {
+			return fmt.Errorf("shard %s volumes: %w", shard.Name, err)
+		}
+
+		if err := ensureDeployment(ctx, c, cluster, spec); err != nil {
 			return fmt.Errorf("ensure shard deployment %s: %w", shard.Name, err)
 		}
 	}
 
-	return nil
+	return waiting
 }
 
 // ---- helpers ----
 
 type DeploymentSpec struct {
-	Name            string
-	Namespace       string
-	Component       string
-	ShardName       string
-	Image           string
-	Replicas        int32
-	ContainerPort   int32
-	ConfigMountPath string
-	PVC             *corev1.PersistentVolumeClaim
-	Env             []corev1.EnvVar
+	Name      string
+	Namespace string
+	Component string
+	ShardName string
+	// Instance is spec.namePrefix, carried in naming.InstanceLabel.
+	Instance      string
+	Image         string
+	Replicas      int32
+	Strategy      appsv1.DeploymentStrategy
+	Resources     corev1.ResourceRequirements
+	Scheduling    *v1alpha1.SchedulingSpec
+	ContainerPort int32
+	// ConfigMapName is the generated configuration ConfigMap and ConfigKey
+	// its entry mounted as the container's appsettings.Production.json.
+	ConfigMapName string
+	ConfigKey     string
+	// ConfigFilesDir, when set, is where every entry of ConfigMapName is
+	// mounted read-only as well.
+	ConfigFilesDir string
+	// ConfigChecksum is stamped on the pod template so pods roll when the
+	// component's configuration changes.
+	ConfigChecksum string
+	PVC            *corev1.PersistentVolumeClaim
+	// Volumes and VolumeMounts are added to the pod and container as is,
+	// e.g. fileserver cache and cold-storage volumes.
+	Volumes      []corev1.Volume
+	VolumeMounts []corev1.VolumeMount
+	Env          []corev1.EnvVar
+}
+
+// FieldOwner is the field manager the operator applies Deployments with.
+const FieldOwner = "honsefarm-operator"
+
+// RetentionPolicyAnnotation records StorageSpec.RetentionPolicy on a data
+// PVC, so the policy is still known after the spec entry is removed.
+const RetentionPolicyAnnotation = "honsefarm.io/retention-policy"
+
+// DeletionPolicyAnnotation records StorageSpec.DeletionPolicy on a data PVC
+// for the storage finalizer.
+const DeletionPolicyAnnotation = "honsefarm.io/deletion-policy"
+
+// legacyFieldManagers wrote Deployments before they were server-side
+// applied: the default field manager derived from the operator binary name.
+var legacyFieldManagers = sets.New[string]("manager")
+
+// configChecksumAnnotation carries DeploymentSpec.ConfigChecksum on the pod
+// template.
+const configChecksumAnnotation = "honsefarm.io/config-checksum"
+
+// dataDirectory is where the data PVC is mounted.
+const dataDirectory = "/data"
+
+// configVolume projects only the component's own ConfigMap entry, renamed to
+// the file name ASP.NET expects.
+func configVolume(spec *DeploymentSpec) corev1.Volume {
+	return corev1.Volume{
+		Name: "config",
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: spec.ConfigMapName,
+				},
+				Items: []corev1.KeyToPath{
+					{
+						Key:  spec.ConfigKey,
+						Path: cfginternal.AppSettingsFile,
+					},
+				},
+			},
+		},
+	}
+}
+
+// configVolumeMount places the projected file next to the application
+// binaries without hiding the rest of cfginternal.AppDir.
+func configVolumeMount() corev1.VolumeMount {
+	return corev1.VolumeMount{
+		Name:      "config",
+		MountPath: path.Join(cfginternal.AppDir, cfginternal.AppSettingsFile),
+		SubPath:   cfginternal.AppSettingsFile,
+		ReadOnly:  true,
+	}
 }
 
+// ensurePVC creates the data PVC of a component. PVCs deliberately carry no
+// owner reference: deleting the cluster must not garbage-collect the data,
+// which is handled by the storage finalizer according to DeletionPolicy.
 func ensurePVC(
 	ctx context.Context,
 	c client.Client,
-	scheme *runtime.Scheme,
 	cluster *v1alpha1.HonseFarmCluster,
 	name string,
 	storage *v1alpha1.StorageSpec,
+	podLabels map[string]string,
 ) (*corev1.PersistentVolumeClaim, error) {
-	ns := namespaceFor(cluster)
+	ns := naming.New(cluster).Namespace()
+
+	labels := naming.New(cluster).WithClusterLabels(podLabels)
+	labels["honsefarm-pvc"] = name
+	annotations := storageAnnotations(storage)
 
 	var existing corev1.PersistentVolumeClaim
 	if err := c.Get(ctx, types.NamespacedName{Name: name, Namespace: ns}, &existing); err == nil {
-		// PVC already exists; don't try to mutate size/class here to avoid conflicts
+		// PVC already exists; don't try to mutate size/class here to avoid conflicts.
+		// Labels and policies are kept current so pruning and the finalizer
+		// can handle the PVC, and a PVC left behind by a deleted cluster is
+		// adopted by this one.
+		changed := false
+		if existing.Labels == nil {
+			existing.Labels = map[string]string{}
+		}
+		for k, v := range labels {
+			if existing.Labels[k] != v {
+				existing.Labels[k] = v
+				changed = true
+			}
+		}
+		if existing.Annotations == nil {
+			existing.Annotations = map[string]string{}
+		}
+		for k, v := range annotations {
+			if existing.Annotations[k] != v {
+				existing.Annotations[k] = v
+				changed = true
+			}
+		}
+		// Grow the request when the storage class allows it; shrinking and
+		// class changes are refused and reported through StorageValid.
+		blocker, _, err := ResizeBlocker(ctx, c, storage, &existing)
+		if err != nil {
+			return nil, err
+		}
+		if blocker == "" {
+			// ResizeBlocker has validated the size.
+			size := resource.MustParse(storage.Size)
+			if size.Cmp(existing.Spec.Resources.Requests[corev1.ResourceStorage]) > 0 {
+				if existing.Spec.Resources.Requests == nil {
+					existing.Spec.Resources.Requests = corev1.ResourceList{}
+				}
+				existing.Spec.Resources.Requests[corev1.ResourceStorage] = size
+				changed = true
+			}
+		}
+		// Drop the owner reference earlier versions set.
+		if refs := naming.WithoutClusterOwner(existing.OwnerReferences); len(refs) != len(existing.OwnerReferences) {
+			existing.OwnerReferences = refs
+			changed = true
+		}
+		if changed {
+			if err := c.Update(ctx, &existing); err != nil {
+				return nil, err
+			}
+		}
 		return &existing, nil
 	} else if !errors.IsNotFound(err) {
 		return nil, err
 	}
 
+	claim, err := claimSpec(storage)
+	if err != nil {
+		return nil, err
+	}
 	pvc := &corev1.PersistentVolumeClaim{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      name,
-			Namespace: ns,
-			Labels: map[string]string{
-				"app.kubernetes.io/managed-by": "honsefarm-operator",
-				"honsefarm-pvc":                name,
-			},
-		},
-		Spec: corev1.PersistentVolumeClaimSpec{
-			Resources: corev1.ResourceRequirements{
-				Requests: corev1.ResourceList{
-					corev1.ResourceStorage: resource.MustParse(storage.Size),
-				},
-			},
+			Name:        name,
+			Namespace:   ns,
+			Labels:      labels,
+			Annotations: annotations,
 		},
+		Spec: claim,
 	}
 
-	// AccessModes
-	if len(storage.AccessModes) > 0 {
-		for _, m := range storage.AccessModes {
-			pvc.Spec.AccessModes = append(pvc.Spec.AccessModes, corev1.PersistentVolumeAccessMode(m))
-		}
-	} else {
-		pvc.Spec.AccessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}
+	if err := c.Create(ctx, pvc); err != nil {
+		return nil, err
 	}
+	return pvc, nil
+}
 
-	// StorageClass
-	if storage.StorageClassName != "" {
-		pvc.Spec.StorageClassName = &storage.StorageClassName
+// storageAnnotations records the retention and deletion policies of storage
+// on its PVCs.
+func storageAnnotations(storage *v1alpha1.StorageSpec) map[string]string {
+	annotations := map[string]string{
+		RetentionPolicyAnnotation: storage.RetentionPolicy,
+		DeletionPolicyAnnotation:  storage.DeletionPolicy,
+	}
+	if annotations[RetentionPolicyAnnotation] == "" {
+		annotations[RetentionPolicyAnnotation] = v1alpha1.RetentionPolicyRetain
+	}
+	if annotations[DeletionPolicyAnnotation] == "" {
+		annotations[DeletionPolicyAnnotation] = v1alpha1.DeletionPolicyRetain
 	}
+	return annotations
+}
 
-	if err := ctrl.SetControllerReference(cluster, pvc, scheme); err != nil {
-		return nil, err
+// componentLabels identifies the pods of a component (and shard) of the
+// cluster with name prefix instance. They also form the Deployment selector,
+// so they must never change for a workload: naming.InstanceLabel is only
+// part of them with a prefix.
+func componentLabels(instance, component, shardName string) map[string]string {
+	labels := map[string]string{
+		"app.kubernetes.io/managed-by": "honsefarm-operator",
+		"honsefarm-component":          component,
 	}
-	if err := c.Create(ctx, pvc); err != nil {
-		return nil, err
+	if shardName != "" {
+		labels["honsefarm-shard"] = shardName
 	}
-	return pvc, nil
+	if instance != "" {
+		labels[naming.InstanceLabel] = instance
+	}
+	return labels
+}
+
+// podLabels are the componentLabels plus naming.InstanceLabel, empty without
+// a prefix. They go on the pod template and into the mutable selectors
+// (Services, anti-affinity, topology spread), which then never match the
+// pods of another cluster in the namespace.
+func podLabels(instance, component, shardName string) map[string]string {
+	labels := componentLabels(instance, component, shardName)
+	labels[naming.InstanceLabel] = instance
+	return labels
 }
 
+// ensureDeployment converges the Deployment described by spec to its
+// complete desired state with a server-side apply. Fields the operator sets
+// are forced back on drift and fields it stops setting are removed; fields
+// owned by other managers are left alone. spec.replicas is not applied while
+// an autoscaler owns it through the scale subresource.
 func ensureDeployment(
 	ctx context.Context,
 	c client.Client,
-	scheme *runtime.Scheme,
 	cluster *v1alpha1.HonseFarmCluster,
 	spec *DeploymentSpec,
 ) error {
-	labels := map[string]string{
-		"app.kubernetes.io/managed-by": "honsefarm-operator",
-		"honsefarm-component":          spec.Component,
-	}
-	if spec.ShardName != "" {
-		labels["honsefarm-shard"] = spec.ShardName
-	}
-
-	runAsNonRoot := true
-	runAsUser := int64(1000)
-	allowPrivilegeEscalation := false
-	seccompProfile := &corev1.SeccompProfile{
-		Type: corev1.SeccompProfileTypeRuntimeDefault,
-	}
-	dropAllCaps := &corev1.Capabilities{
-		Drop: []corev1.Capability{"ALL"},
-	}
+	dep := desiredDeployment(cluster, spec)
 
 	var existing appsv1.Deployment
 	if err := c.Get(ctx, types.NamespacedName{Name: spec.Name, Namespace: spec.Namespace}, &existing); err != nil {
 		if !errors.IsNotFound(err) {
 			return err
 		}
+	} else {
+		if err := upgradeManagedFields(ctx, c, &existing); err != nil {
+			return fmt.Errorf("migrate field ownership of deployment %s: %w", spec.Name, err)
+		}
+		if replicasScaledElsewhere(&existing) {
+			dep.Spec.Replicas = nil
+		}
+		// rollingUpdate may have been filled in by defaulting or another
+		// manager, and a Recreate Deployment must not have it, so clear it
+		// before applying.
+		if spec.Strategy.Type == appsv1.RecreateDeploymentStrategyType && existing.Spec.Strategy.RollingUpdate != nil {
+			patch := []byte(`{"spec":{"strategy":{"type":"Recreate","rollingUpdate":null}}}`)
+			if err := c.Patch(ctx, &existing, client.RawPatch(types.MergePatchType, patch)); err != nil {
+				return fmt.Errorf("switch deployment %s to Recreate: %w", spec.Name, err)
+			}
+		}
+	}
+
+	return c.Patch(ctx, dep, client.Apply, client.FieldOwner(FieldOwner), client.ForceOwnership)
+}
+
+// desiredDeployment renders the complete Deployment for spec.
+func desiredDeployment(cluster *v1alpha1.HonseFarmCluster, spec *DeploymentSpec) *appsv1.Deployment {
+	labels := componentLabels(spec.Instance, spec.Component, spec.ShardName)
+	replicas := spec.Replicas
+
+	return &appsv1.Deployment{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: appsv1.SchemeGroupVersion.String(),
+			Kind:       "Deployment",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      spec.Name,
+			Namespace: spec.Namespace,
+			Labels:    naming.New(cluster).WithClusterLabels(labels),
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labels,
+			},
+			Strategy: spec.Strategy,
+			Template: podTemplate(spec),
+		},
+	}
+}
+
+// podTemplate renders the pod template shared by the Deployment and
+// StatefulSet layouts.
+func podTemplate(spec *DeploymentSpec) corev1.PodTemplateSpec {
+	runAsNonRoot := true
+	runAsUser := int64(1000)
+	allowPrivilegeEscalation := false
 
-		// Create new Deployment
-		dep := &appsv1.Deployment{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      spec.Name,
-				Namespace: spec.Namespace,
-				Labels:    labels,
+	template := corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: podLabels(spec.Instance, spec.Component, spec.ShardName),
+			Annotations: map[string]string{
+				configChecksumAnnotation: spec.ConfigChecksum,
 			},
-			Spec: appsv1.DeploymentSpec{
-				Replicas: &spec.Replicas,
-				Selector: &metav1.LabelSelector{
-					MatchLabels: labels,
+		},
+		Spec: corev1.PodSpec{
+			SecurityContext: &corev1.PodSecurityContext{
+				RunAsNonRoot: &runAsNonRoot,
+				RunAsUser:    &runAsUser,
+				SeccompProfile: &corev1.SeccompProfile{
+					Type: corev1.SeccompProfileTypeRuntimeDefault,
 				},
-				Template: corev1.PodTemplateSpec{
-					ObjectMeta: metav1.ObjectMeta{
-						Labels: labels,
-					},
-					Spec: corev1.PodSpec{
-						SecurityContext: &corev1.PodSecurityContext{
-							RunAsNonRoot:   &runAsNonRoot,
-							RunAsUser:      &runAsUser,
-							SeccompProfile: seccompProfile,
-						},
-						Containers: []corev1.Container{
-							{
-								Name:  spec.Component,
-								Image: spec.Image,
-								Ports: []corev1.ContainerPort{
-									{
-										ContainerPort: spec.ContainerPort,
-									},
-								},
-								Env: spec.Env,
-								SecurityContext: &corev1.SecurityContext{
-									AllowPrivilegeEscalation: &allowPrivilegeEscalation,
-									RunAsNonRoot:             &runAsNonRoot,
-									RunAsUser:                &runAsUser,
-									Capabilities:             dropAllCaps,
-								},
-								VolumeMounts: []corev1.VolumeMount{
-									{
-										Name:      "config",
-										MountPath: spec.ConfigMountPath,
-										ReadOnly:  true,
-									},
-								},
-							},
+			},
+			Containers: []corev1.Container{
+				{
+					Name:  spec.Component,
+					Image: spec.Image,
+					Ports: []corev1.ContainerPort{
+						{
+							Name:          "http",
+							ContainerPort: spec.ContainerPort,
+							Protocol:      corev1.ProtocolTCP,
 						},
-						Volumes: []corev1.Volume{
-							{
-								Name: "config",
-								VolumeSource: corev1.VolumeSource{
-									ConfigMap: &corev1.ConfigMapVolumeSource{
-										LocalObjectReference: corev1.LocalObjectReference{
-											Name: "honsefarm-config",
-										},
-									},
-								},
-							},
+					},
+					Env:       spec.Env,
+					Resources: spec.Resources,
+					SecurityContext: &corev1.SecurityContext{
+						AllowPrivilegeEscalation: &allowPrivilegeEscalation,
+						RunAsNonRoot:             &runAsNonRoot,
+						RunAsUser:                &runAsUser,
+						Capabilities: &corev1.Capabilities{
+							Drop: []corev1.Capability{"ALL"},
 						},
 					},
+					VolumeMounts: []corev1.VolumeMount{
+						configVolumeMount(),
+					},
 				},
 			},
-		}
+			Volumes: []corev1.Volume{
+				configVolume(spec),
+			},
+		},
+	}
 
-		// Attach PVC if present
-		if spec.PVC != nil {
-			dep.Spec.Template.Spec.Volumes = append(dep.Spec.Template.Spec.Volumes, corev1.Volume{
-				Name: "data",
-				VolumeSource: corev1.VolumeSource{
-					PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
-						ClaimName: spec.PVC.Name,
-					},
-				},
-			})
-			dep.Spec.Template.Spec.Containers[0].VolumeMounts = append(
-				dep.Spec.Template.Spec.Containers[0].VolumeMounts,
-				corev1.VolumeMount{
-					Name:      "data",
-					MountPath: "/data",
+	if spec.ConfigFilesDir != "" {
+		template.Spec.Volumes = append(template.Spec.Volumes, corev1.Volume{
+			Name: "config-files",
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: spec.ConfigMapName},
 				},
-			)
-		}
+			},
+		})
+		template.Spec.Containers[0].VolumeMounts = append(
+			template.Spec.Containers[0].VolumeMounts,
+			corev1.VolumeMount{
+				Name:      "config-files",
+				MountPath: spec.ConfigFilesDir,
+				ReadOnly:  true,
+			},
+		)
+	}
 
-		if err := ctrl.SetControllerReference(cluster, dep, scheme); err != nil {
-			return err
-		}
-		return c.Create(ctx, dep)
+	// Attach PVC if present
+	if spec.PVC != nil {
+		template.Spec.Volumes = append(template.Spec.Volumes, corev1.Volume{
+			Name: "data",
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: spec.PVC.Name,
+				},
+			},
+		})
+		template.Spec.Containers[0].VolumeMounts = append(
+			template.Spec.Containers[0].VolumeMounts,
+			corev1.VolumeMount{
+				Name:      "data",
+				MountPath: dataDirectory,
+			},
+		)
 	}
 
-	// Update path
-	existing.Spec.Replicas = &spec.Replicas
+	applyScheduling(&template.Spec, spec)
+
+	template.Spec.Volumes = append(template.Spec.Volumes, spec.Volumes...)
+	template.Spec.Containers[0].VolumeMounts = append(
+		template.Spec.Containers[0].VolumeMounts, spec.VolumeMounts...)
+
+	return template
+}
 
-	// Ensure pod-level security context matches restricted policy
-	existing.Spec.Template.Spec.SecurityContext = &corev1.PodSecurityContext{
-		RunAsNonRoot:   &runAsNonRoot,
-		RunAsUser:      &runAsUser,
-		SeccompProfile: seccompProfile,
+// upgradeManagedFields hands the fields that earlier operator versions wrote
+// with Create/Update over to FieldOwner, so the first apply can remove the
+// ones it no longer sets instead of leaving them behind.
+func upgradeManagedFields(ctx context.Context, c client.Client, obj client.Object) error {
+	patch, err := csaupgrade.UpgradeManagedFieldsPatch(obj, legacyFieldManagers, FieldOwner)
+	if err != nil || patch == nil {
+		return err
 	}
+	return c.Patch(ctx, obj, client.RawPatch(types.JSONPatchType, patch))
+}
 
-	// Ensure container-level security context matches restricted policy
-	if len(existing.Spec.Template.Spec.Containers) > 0 {
-		existing.Spec.Template.Spec.Containers[0].Image = spec.Image
-		existing.Spec.Template.Spec.Containers[0].SecurityContext = &corev1.SecurityContext{
-			AllowPrivilegeEscalation: &allowPrivilegeEscalation,
-			RunAsNonRoot:             &runAsNonRoot,
-			RunAsUser:                &runAsUser,
-			Capabilities:             dropAllCaps,
+// replicasScaledElsewhere reports whether spec.replicas of obj is owned by a
+// manager writing through the scale subresource, such as the
+// HorizontalPodAutoscaler.
+func replicasScaledElsewhere(obj client.Object) bool {
+	for _, entry := range obj.GetManagedFields() {
+		if entry.Manager == FieldOwner || entry.Subresource != "scale" || entry.FieldsV1 == nil {
+			continue
+		}
+		var fields struct {
+			Spec map[string]json.RawMessage `json:"f:spec"`
+		}
+		if err := json.Unmarshal(entry.FieldsV1.Raw, &fields); err != nil {
+			continue
+		}
+		if _, ok := fields.Spec["f:replicas"]; ok {
+			return true
 		}
 	}
-
-	return c.Update(ctx, &existing)
+	return false
 }
@@ -0,0 +1,209 @@
+package naming
+
+import (
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	v1alpha1 "honsefarm-operator/api/v1alpha1"
+)
+
+// Labels identifying the HonseFarmCluster an object belongs to. They are
+// set on every object the operator creates for a cluster, never on
+// selectors, and are used to find objects that are no longer desired.
+const (
+	ClusterLabel          = "honsefarm.io/cluster"
+	ClusterNamespaceLabel = "honsefarm.io/cluster-namespace"
+)
+
+// InstanceLabel carries spec.namePrefix, empty without one. It is always set
+// on pods and always part of Service selectors, so the Services of clusters
+// sharing a namespace select only their own pods.
+//
+// The immutable Deployment and StatefulSet selectors only include it with a
+// prefix. Workloads of existing unprefixed clusters therefore keep their
+// selectors on upgrade and are not migrated; their pods just roll to carry
+// the empty label. Since those selectors would also match the pods of a
+// prefixed cluster, a namespace is not shared between a cluster with and
+// one without a prefix (see the NamespaceConflict condition).
+const InstanceLabel = "honsefarm.io/instance"
+
+// Service is an in-cluster Service fronting a component.
+type Service struct {
+	Name      string
+	Namespace string
+	Port      int32
+}
+
+// Host returns the namespace-qualified DNS name of the Service.
+func (s Service) Host() string {
+	return fmt.Sprintf("%s.%s.svc.cluster.local", s.Name, s.Namespace)
+}
+
+// URL returns the plain HTTP address of the Service.
+func (s Service) URL() string {
+	return fmt.Sprintf("http://%s:%d", s.Host(), s.Port)
+}
+
+// Headless returns the headless Service giving the pods behind s stable
+// per-pod DNS names.
+func (s Service) Headless() Service {
+	s.Name += "-headless"
+	return s
+}
+
+// Names computes the names and addresses of the objects created for a
+// cluster. The controller creates Services from it and the configuration
+// generator points components at them, so both always agree.
+type Names struct {
+	namespace string
+	prefix    string
+
+	serverPort         int32
+	adminPanelPort     int32
+	mainFileserverPort int32
+	shardPorts         map[string]int32
+
+	clusterName      string
+	clusterNamespace string
+}
+
+// New returns the Names of cluster, whose spec is expected to be defaulted.
+// Only the namespace falls back to its default, for indexers and watches
+// that see clusters as stored.
+func New(cluster *v1alpha1.HonseFarmCluster) Names {
+	ns := cluster.Spec.Namespace
+	if ns == "" {
+		ns = v1alpha1.DefaultNamespace
+	}
+	n := Names{
+		namespace:        ns,
+		prefix:           cluster.Spec.NamePrefix,
+		clusterName:      cluster.Name,
+		clusterNamespace: cluster.Namespace,
+		shardPorts:       map[string]int32{},
+	}
+	if comps := cluster.Spec.Components; comps != nil {
+		if comps.Server != nil {
+			n.serverPort = comps.Server.Port
+		}
+		if comps.AdminPanel != nil {
+			n.adminPanelPort = comps.AdminPanel.Port
+		}
+		if fs := comps.Fileservers; fs != nil {
+			if fs.Main != nil {
+				n.mainFileserverPort = fs.Main.Port
+			}
+			for _, shard := range fs.Shards {
+				n.shardPorts[shard.Name] = shard.Port
+			}
+		}
+	}
+	return n
+}
+
+// Namespace is the namespace the cluster's workloads run in.
+func (n Names) Namespace() string {
+	return n.namespace
+}
+
+// SecretNamespaceAllowed reports whether a secret reference of the cluster
+// may point into ns, empty meaning spec.namespace. Only the cluster's own
+// namespace and spec.namespace are: the operator reads Secrets with its
+// cluster-wide RBAC and renders them where editors of the cluster can read
+// them, which would otherwise expose Secrets they have no access to.
+func (n Names) SecretNamespaceAllowed(ns string) bool {
+	return ns == "" || ns == n.namespace || ns == n.clusterNamespace
+}
+
+// Prefix is spec.namePrefix, empty without one.
+func (n Names) Prefix() string {
+	return n.prefix
+}
+
+// Name returns the name of the object called base for this cluster: base
+// prefixed with spec.namePrefix, or base itself without a prefix.
+func (n Names) Name(base string) string {
+	if n.prefix == "" {
+		return base
+	}
+	return n.prefix + "-" + base
+}
+
+// ClusterLabels returns the labels identifying the cluster.
+func (n Names) ClusterLabels() map[string]string {
+	return map[string]string{
+		ClusterLabel:          n.clusterName,
+		ClusterNamespaceLabel: n.clusterNamespace,
+	}
+}
+
+// WithClusterLabels returns a copy of labels with the ClusterLabels added.
+func (n Names) WithClusterLabels(labels map[string]string) map[string]string {
+	out := make(map[string]string, len(labels)+2)
+	for k, v := range labels {
+		out[k] = v
+	}
+	for k, v := range n.ClusterLabels() {
+		out[k] = v
+	}
+	return out
+}
+
+// Track labels obj as belonging to the cluster and drops owner references to
+// a HonseFarmCluster. Owner references cannot cross namespaces and the
+// cluster usually lives outside spec.namespace, where the garbage collector
+// would delete such children as orphans. The labels take their place:
+// watches map events on labelled objects back to the cluster and its
+// finalizer deletes them. It reports whether obj changed.
+func (n Names) Track(obj metav1.Object) bool {
+	changed := false
+	labels := obj.GetLabels()
+	for k, v := range n.ClusterLabels() {
+		if labels[k] != v {
+			changed = true
+		}
+	}
+	if changed {
+		obj.SetLabels(n.WithClusterLabels(labels))
+	}
+	if refs := WithoutClusterOwner(obj.GetOwnerReferences()); len(refs) != len(obj.GetOwnerReferences()) {
+		obj.SetOwnerReferences(refs)
+		changed = true
+	}
+	return changed
+}
+
+// WithoutClusterOwner filters out owner references to a HonseFarmCluster,
+// which earlier operator versions set.
+func WithoutClusterOwner(refs []metav1.OwnerReference) []metav1.OwnerReference {
+	var out []metav1.OwnerReference
+	for _, ref := range refs {
+		if ref.Kind == "HonseFarmCluster" && strings.HasPrefix(ref.APIVersion, v1alpha1.GroupVersion.Group+"/") {
+			continue
+		}
+		out = append(out, ref)
+	}
+	return out
+}
+
+// ServerService fronts the core server on its spec.components.server.port.
+func (n Names) ServerService() Service {
+	return Service{Name: n.Name("server-svc"), Namespace: n.namespace, Port: n.serverPort}
+}
+
+// AdminPanelService fronts the admin panel.
+func (n Names) AdminPanelService() Service {
+	return Service{Name: n.Name("adminpanel-svc"), Namespace: n.namespace, Port: n.adminPanelPort}
+}
+
+// MainFileserverService fronts the main fileserver.
+func (n Names) MainFileserverService() Service {
+	return Service{Name: n.Name("main-fileserver-svc"), Namespace: n.namespace, Port: n.mainFileserverPort}
+}
+
+// ShardService fronts the named shard fileserver.
+func (n Names) ShardService(shard string) Service {
+	return Service{Name: n.Name(fmt.Sprintf("shard-%s-svc", shard)), Namespace: n.namespace, Port: n.shardPorts[shard]}
+}
@@ -0,0 +1,133 @@
+// Package sizing holds the presets selected by spec.sizingProfile. The
+// workload builders take replicas and resources from it and the
+// configuration generator takes pool and cache sizes, so one profile sizes
+// every component consistently. Values set on a component always win.
+package sizing
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	v1alpha1 "honsefarm-operator/api/v1alpha1"
+)
+
+// Profile names accepted in spec.sizingProfile.
+const (
+	Tiny  = "tiny"
+	Small = "small"
+	Large = "large"
+)
+
+// Component is the preset of one component. Zero fields keep the operator's
+// defaults.
+type Component struct {
+	Replicas  int32
+	Resources corev1.ResourceRequirements
+	// DbContextPoolSize and CacheSizeHardLimitInGiB go into the generated
+	// appsettings.
+	DbContextPoolSize       int
+	CacheSizeHardLimitInGiB int64
+}
+
+// Profile presets every component of a cluster.
+type Profile struct {
+	Server          Component
+	AdminPanel      Component
+	MainFileserver  Component
+	ShardFileserver Component
+}
+
+var profiles = map[string]Profile{
+	Tiny: {
+		Server:          Component{Replicas: 1, Resources: resources("100m", "256Mi", "512Mi"), DbContextPoolSize: 128},
+		AdminPanel:      Component{Replicas: 1, Resources: resources("50m", "128Mi", "256Mi")},
+		MainFileserver:  Component{Replicas: 1, Resources: resources("100m", "256Mi", "512Mi"), DbContextPoolSize: 64, CacheSizeHardLimitInGiB: 5},
+		ShardFileserver: Component{Replicas: 1, Resources: resources("100m", "256Mi", "512Mi"), DbContextPoolSize: 64, CacheSizeHardLimitInGiB: 10},
+	},
+	Small: {
+		Server:          Component{Replicas: 1, Resources: resources("250m", "512Mi", "1Gi"), DbContextPoolSize: 512},
+		AdminPanel:      Component{Replicas: 1, Resources: resources("100m", "256Mi", "512Mi")},
+		MainFileserver:  Component{Replicas: 1, Resources: resources("250m", "512Mi", "1Gi"), DbContextPoolSize: 256, CacheSizeHardLimitInGiB: 25},
+		ShardFileserver: Component{Replicas: 1, Resources: resources("250m", "512Mi", "1Gi"), DbContextPoolSize: 256, CacheSizeHardLimitInGiB: 50},
+	},
+	Large: {
+		Server:          Component{Replicas: 2, Resources: resources("1", "2Gi", "4Gi"), DbContextPoolSize: 2000},
+		AdminPanel:      Component{Replicas: 2, Resources: resources("250m", "512Mi", "1Gi")},
+		MainFileserver:  Component{Replicas: 1, Resources: resources("1", "2Gi", "4Gi"), DbContextPoolSize: 512, CacheSizeHardLimitInGiB: 100},
+		ShardFileserver: Component{Replicas: 2, Resources: resources("1", "2Gi", "4Gi"), DbContextPoolSize: 512, CacheSizeHardLimitInGiB: 250},
+	},
+}
+
+// resources requests cpu and memory and limits memory. CPU is left
+// unlimited so request bursts are not throttled.
+func resources(cpu, memory, memoryLimit string) corev1.ResourceRequirements {
+	return corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse(cpu),
+			corev1.ResourceMemory: resource.MustParse(memory),
+		},
+		Limits: corev1.ResourceList{
+			corev1.ResourceMemory: resource.MustParse(memoryLimit),
+		},
+	}
+}
+
+// For returns the profile called name. The empty name selects no presets.
+func For(name string) (Profile, error) {
+	if name == "" {
+		return Profile{}, nil
+	}
+	p, ok := profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("unknown sizingProfile %q", name)
+	}
+	return p, nil
+}
+
+// Of returns the profile of cluster. An unknown profile yields no presets;
+// the configuration build reports it.
+func Of(cluster *v1alpha1.HonseFarmCluster) Profile {
+	p, _ := For(cluster.Spec.SizingProfile)
+	return p
+}
+
+// Resources overlays the requests and limits set on a component onto the
+// preset, resource by resource.
+func Resources(preset corev1.ResourceRequirements, explicit *corev1.ResourceRequirements) corev1.ResourceRequirements {
+	out := corev1.ResourceRequirements{
+		Requests: overlay(preset.Requests, nil),
+		Limits:   overlay(preset.Limits, nil),
+	}
+	if explicit != nil {
+		out.Requests = overlay(out.Requests, explicit.Requests)
+		out.Limits = overlay(out.Limits, explicit.Limits)
+		out.Claims = explicit.Claims
+		// A preset limit must not end up below a request raised on the
+		// component.
+		for name, request := range explicit.Requests {
+			if _, set := explicit.Limits[name]; set {
+				continue
+			}
+			if limit, ok := out.Limits[name]; ok && limit.Cmp(request) < 0 {
+				out.Limits[name] = request.DeepCopy()
+			}
+		}
+	}
+	return out
+}
+
+func overlay(base, over corev1.ResourceList) corev1.ResourceList {
+	if len(base) == 0 && len(over) == 0 {
+		return nil
+	}
+	out := corev1.ResourceList{}
+	for name, q := range base {
+		out[name] = q.DeepCopy()
+	}
+	for name, q := range over {
+		out[name] = q.DeepCopy()
+	}
+	return out
+}
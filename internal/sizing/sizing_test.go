@@ -0,0 +1,106 @@
+package sizing
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func requirements(requests, limits map[corev1.ResourceName]string) corev1.ResourceRequirements {
+	list := func(in map[corev1.ResourceName]string) corev1.ResourceList {
+		if in == nil {
+			return nil
+		}
+		out := corev1.ResourceList{}
+		for name, q := range in {
+			out[name] = resource.MustParse(q)
+		}
+		return out
+	}
+	return corev1.ResourceRequirements{Requests: list(requests), Limits: list(limits)}
+}
+
+func TestResources(t *testing.T) {
+	preset := requirements(
+		map[corev1.ResourceName]string{corev1.ResourceCPU: "500m", corev1.ResourceMemory: "1Gi"},
+		map[corev1.ResourceName]string{corev1.ResourceMemory: "2Gi"},
+	)
+
+	tests := []struct {
+		name     string
+		preset   corev1.ResourceRequirements
+		explicit *corev1.ResourceRequirements
+		want     corev1.ResourceRequirements
+	}{
+		{
+			name: "no preset, nothing set",
+		},
+		{
+			name:   "preset only",
+			preset: preset,
+			want:   preset,
+		},
+		{
+			name:     "nothing preset",
+			explicit: &corev1.ResourceRequirements{Requests: requirements(map[corev1.ResourceName]string{corev1.ResourceCPU: "1"}, nil).Requests},
+			want:     requirements(map[corev1.ResourceName]string{corev1.ResourceCPU: "1"}, nil),
+		},
+		{
+			name:   "overlays resource by resource",
+			preset: preset,
+			explicit: &corev1.ResourceRequirements{
+				Requests: requirements(map[corev1.ResourceName]string{corev1.ResourceCPU: "2"}, nil).Requests,
+			},
+			want: requirements(
+				map[corev1.ResourceName]string{corev1.ResourceCPU: "2", corev1.ResourceMemory: "1Gi"},
+				map[corev1.ResourceName]string{corev1.ResourceMemory: "2Gi"},
+			),
+		},
+		{
+			name:   "raised request lifts the preset limit",
+			preset: preset,
+			explicit: &corev1.ResourceRequirements{
+				Requests: requirements(map[corev1.ResourceName]string{corev1.ResourceMemory: "4Gi"}, nil).Requests,
+			},
+			want: requirements(
+				map[corev1.ResourceName]string{corev1.ResourceCPU: "500m", corev1.ResourceMemory: "4Gi"},
+				map[corev1.ResourceName]string{corev1.ResourceMemory: "4Gi"},
+			),
+		},
+		{
+			name:   "explicit limit is kept",
+			preset: preset,
+			explicit: &corev1.ResourceRequirements{
+				Requests: requirements(map[corev1.ResourceName]string{corev1.ResourceMemory: "4Gi"}, nil).Requests,
+				Limits:   requirements(nil, map[corev1.ResourceName]string{corev1.ResourceMemory: "3Gi"}).Limits,
+			},
+			want: requirements(
+				map[corev1.ResourceName]string{corev1.ResourceCPU: "500m", corev1.ResourceMemory: "4Gi"},
+				map[corev1.ResourceName]string{corev1.ResourceMemory: "3Gi"},
+			),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Resources(tt.preset, tt.explicit)
+			if !equality.Semantic.DeepEqual(got, tt.want) {
+				t.Errorf("Resources() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResourcesDoesNotAliasPreset(t *testing.T) {
+	preset := requirements(map[corev1.ResourceName]string{corev1.ResourceCPU: "500m"}, nil)
+	got := Resources(preset, &corev1.ResourceRequirements{
+		Requests: requirements(map[corev1.ResourceName]string{corev1.ResourceCPU: "1"}, nil).Requests,
+	})
+	got.Requests[corev1.ResourceMemory] = resource.MustParse("1Gi")
+
+	if len(preset.Requests) != 1 || preset.Requests.Cpu().String() != "500m" {
+		t.Errorf("preset changed to %v", preset.Requests)
+	}
+}
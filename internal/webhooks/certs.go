@@ -0,0 +1,261 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"honsefarm-operator/internal/certs"
+)
+
+//+kubebuilder:rbac:groups=admissionregistration.k8s.io,resources=validatingwebhookconfigurations;mutatingwebhookconfigurations,verbs=get;list;watch;update;patch
+
+// Keys of the webhook certificate Secret besides tls.crt and tls.key.
+const (
+	caCertKey = "ca.crt"
+	caKeyKey  = "ca.key"
+	// previousCACertKey keeps the CA replaced by the last CA rotation in
+	// the caBundle until it expires, so replicas still serving a leaf
+	// signed by it are trusted until they pick up the new one.
+	previousCACertKey = "ca-previous.crt"
+)
+
+// certCheckInterval is how often CertRotator checks the Secret, the files
+// and the caBundles. It is short so a caBundle wiped by re-applying the
+// webhook configurations is restored quickly.
+const certCheckInterval = time.Minute
+
+// CertRotator generates the CA and serving certificate of the webhook server
+// and keeps them in a Secret shared by all operator replicas. It writes the
+// serving certificate to the server's certificate directory, where the
+// server picks up changes, and patches the CA into the caBundle of the
+// webhook configurations. It runs on every replica, not just the leader,
+// since every replica serves the webhooks.
+type CertRotator struct {
+	// Client must not read from the manager's cache: Ensure runs before the
+	// manager is started.
+	Client client.Client
+
+	// SecretName and Namespace locate the certificate Secret; Namespace is
+	// also the namespace of the webhook Service called ServiceName.
+	SecretName  string
+	Namespace   string
+	ServiceName string
+	// ConfigurationName names both the ValidatingWebhookConfiguration and
+	// the MutatingWebhookConfiguration.
+	ConfigurationName string
+	// CertDir is the webhook server's certificate directory.
+	CertDir string
+}
+
+// Start implements manager.Runnable, ensuring the certificates every
+// certCheckInterval until ctx is done.
+func (r *CertRotator) Start(ctx context.Context) error {
+	logger := log.FromContext(ctx).WithName("webhook-certs")
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := r.Ensure(ctx); err != nil {
+			logger.Error(err, "failed to ensure webhook certificates")
+		}
+	}, certCheckInterval)
+	return nil
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable.
+func (r *CertRotator) NeedLeaderElection() bool {
+	return false
+}
+
+// Ensure issues or rotates the certificates as needed, writes the serving
+// certificate to CertDir and patches the caBundles. Call it before starting
+// the manager, whose webhook server needs the files to start.
+func (r *CertRotator) Ensure(ctx context.Context) error {
+	var secret *corev1.Secret
+	// Another replica may create or rotate the Secret at the same time;
+	// start over from its version then.
+	err := retry.OnError(retry.DefaultRetry, func(err error) bool {
+		return apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err)
+	}, func() error {
+		var err error
+		secret, err = r.ensureSecret(ctx, time.Now())
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("ensure webhook certificate secret: %w", err)
+	}
+
+	if err := r.writeFiles(secret); err != nil {
+		return fmt.Errorf("write webhook certificate: %w", err)
+	}
+	return r.patchCABundles(ctx, caBundle(secret, time.Now()))
+}
+
+// dnsNames are the names the API server may use to reach the webhook
+// Service.
+func (r *CertRotator) dnsNames() []string {
+	return []string{
+		fmt.Sprintf("%s.%s.svc", r.ServiceName, r.Namespace),
+		fmt.Sprintf("%s.%s.svc.cluster.local", r.ServiceName, r.Namespace),
+	}
+}
+
+// ensureSecret loads the certificate Secret, generating the CA when it is
+// missing, unreadable or due for renewal and the serving certificate when
+// certs.NeedsRenewal says so.
+func (r *CertRotator) ensureSecret(ctx context.Context, now time.Time) (*corev1.Secret, error) {
+	logger := log.FromContext(ctx).WithName("webhook-certs")
+
+	secret := &corev1.Secret{}
+	err := r.Client.Get(ctx, types.NamespacedName{Name: r.SecretName, Namespace: r.Namespace}, secret)
+	if apierrors.IsNotFound(err) {
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      r.SecretName,
+				Namespace: r.Namespace,
+				Labels: map[string]string{
+					"app.kubernetes.io/managed-by": "honsefarm-operator",
+					"app.kubernetes.io/name":       r.SecretName,
+				},
+			},
+			Type: corev1.SecretTypeTLS,
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	data := map[string][]byte{}
+	for k, v := range secret.Data {
+		data[k] = v
+	}
+	changed := false
+
+	ca, caErr := certs.Parse(data[caCertKey], data[caKeyKey])
+	if caErr != nil || !certs.Matches(ca) || !now.Before(certs.RenewAt(ca.Cert)) {
+		if caErr == nil && now.Before(ca.Cert.NotAfter) {
+			data[previousCACertKey] = ca.CertPEM
+		}
+		ca, err = certs.NewCA(fmt.Sprintf("%s.%s", r.SecretName, r.Namespace), now)
+		if err != nil {
+			return nil, err
+		}
+		data[caCertKey], data[caKeyKey] = ca.CertPEM, ca.KeyPEM
+		changed = true
+		logger.Info("issued webhook CA", "notAfter", ca.Cert.NotAfter)
+	}
+
+	leaf, leafErr := certs.Parse(data[corev1.TLSCertKey], data[corev1.TLSPrivateKeyKey])
+	if leafErr != nil || !certs.Matches(leaf) || certs.NeedsRenewal(leaf.Cert, ca.Cert, r.dnsNames(), now) {
+		leaf, err = certs.NewLeaf(ca, r.dnsNames(), now)
+		if err != nil {
+			return nil, err
+		}
+		data[corev1.TLSCertKey], data[corev1.TLSPrivateKeyKey] = leaf.CertPEM, leaf.KeyPEM
+		changed = true
+		logger.Info("issued webhook serving certificate", "dnsNames", r.dnsNames(), "notAfter", leaf.Cert.NotAfter)
+	}
+
+	if !changed {
+		return secret, nil
+	}
+	secret.Data = data
+	if secret.ResourceVersion == "" {
+		return secret, r.Client.Create(ctx, secret)
+	}
+	return secret, r.Client.Update(ctx, secret)
+}
+
+// caBundle is the CA of secret, followed by the CA it replaced while that
+// one has not expired.
+func caBundle(secret *corev1.Secret, now time.Time) []byte {
+	bundle := append([]byte(nil), secret.Data[caCertKey]...)
+	if previous := secret.Data[previousCACertKey]; len(previous) > 0 {
+		if block, _ := pem.Decode(previous); block != nil {
+			if cert, err := x509.ParseCertificate(block.Bytes); err == nil && now.Before(cert.NotAfter) {
+				bundle = append(bundle, previous...)
+			}
+		}
+	}
+	return bundle
+}
+
+// writeFiles writes the serving certificate of secret to CertDir where it
+// differs from what is there. The key goes first, so the server never pairs
+// a new certificate with the old key for longer than the second write.
+func (r *CertRotator) writeFiles(secret *corev1.Secret) error {
+	if err := os.MkdirAll(r.CertDir, 0o700); err != nil {
+		return err
+	}
+	for _, key := range []string{corev1.TLSPrivateKeyKey, corev1.TLSCertKey} {
+		path := filepath.Join(r.CertDir, key)
+		current, err := os.ReadFile(path)
+		if err == nil && bytes.Equal(current, secret.Data[key]) {
+			continue
+		}
+		if err := os.WriteFile(path, secret.Data[key], 0o600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// patchCABundles sets bundle as the caBundle of every webhook in the
+// configurations called ConfigurationName. A missing configuration is
+// skipped: it is patched once it exists.
+func (r *CertRotator) patchCABundles(ctx context.Context, bundle []byte) error {
+	logger := log.FromContext(ctx).WithName("webhook-certs")
+	key := types.NamespacedName{Name: r.ConfigurationName}
+
+	var validating admissionregistrationv1.ValidatingWebhookConfiguration
+	if err := r.Client.Get(ctx, key, &validating); err == nil {
+		patch := client.MergeFrom(validating.DeepCopy())
+		changed := false
+		for i := range validating.Webhooks {
+			if !bytes.Equal(validating.Webhooks[i].ClientConfig.CABundle, bundle) {
+				validating.Webhooks[i].ClientConfig.CABundle = bundle
+				changed = true
+			}
+		}
+		if changed {
+			if err := r.Client.Patch(ctx, &validating, patch); err != nil {
+				return fmt.Errorf("patch caBundle of ValidatingWebhookConfiguration %s: %w", r.ConfigurationName, err)
+			}
+			logger.Info("patched caBundle", "validatingWebhookConfiguration", r.ConfigurationName)
+		}
+	} else if !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	var mutating admissionregistrationv1.MutatingWebhookConfiguration
+	if err := r.Client.Get(ctx, key, &mutating); err == nil {
+		patch := client.MergeFrom(mutating.DeepCopy())
+		changed := false
+		for i := range mutating.Webhooks {
+			if !bytes.Equal(mutating.Webhooks[i].ClientConfig.CABundle, bundle) {
+				mutating.Webhooks[i].ClientConfig.CABundle = bundle
+				changed = true
+			}
+		}
+		if changed {
+			if err := r.Client.Patch(ctx, &mutating, patch); err != nil {
+				return fmt.Errorf("patch caBundle of MutatingWebhookConfiguration %s: %w", r.ConfigurationName, err)
+			}
+			logger.Info("patched caBundle", "mutatingWebhookConfiguration", r.ConfigurationName)
+		}
+	} else if !apierrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
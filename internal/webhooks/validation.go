@@ -0,0 +1,357 @@
+package webhooks
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	apivalidation "k8s.io/apimachinery/pkg/api/validation"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	v1alpha1 "honsefarm-operator/api/v1alpha1"
+	"honsefarm-operator/internal/cloudflared"
+	cfginternal "honsefarm-operator/internal/config"
+	coreinternal "honsefarm-operator/internal/core"
+	"honsefarm-operator/internal/naming"
+)
+
+// maxStatefulSetNameLength leaves room in the 63-character
+// controller-revision-hash label of StatefulSet pods, which the StatefulSet
+// controller sets to the name followed by "-" and a hash of up to 10
+// characters.
+const maxStatefulSetNameLength = 52
+
+// maxNamePrefixLength matches the MaxLength of spec.namePrefix in the CRD
+// schema.
+const maxNamePrefixLength = 20
+
+// Validate checks the spec of cluster for mistakes the controller would
+// otherwise only run into while reconciling, over and over.
+func Validate(cluster *v1alpha1.HonseFarmCluster) field.ErrorList {
+	spec := field.NewPath("spec")
+
+	var errs field.ErrorList
+	errs = append(errs, validateNamePrefix(cluster.Spec.NamePrefix, spec.Child("namePrefix"))...)
+	errs = append(errs, validateImages(cluster, spec.Child("images"))...)
+	errs = append(errs, validateComponents(cluster, spec.Child("components"))...)
+	errs = append(errs, validateCloudflared(cluster, spec.Child("cloudflared"))...)
+	errs = append(errs, validateSecretRefs(cluster)...)
+	return errs
+}
+
+// ValidateUpdate checks that the update from old to cluster leaves the
+// fields alone that cannot be converged in place: the namespace and name
+// prefix every object was created under and the storage class of existing
+// PVCs.
+func ValidateUpdate(old, cluster *v1alpha1.HonseFarmCluster) field.ErrorList {
+	spec := field.NewPath("spec")
+	oldNames, names := naming.New(old), naming.New(cluster)
+
+	var errs field.ErrorList
+	errs = append(errs, apivalidation.ValidateImmutableField(names.Namespace(), oldNames.Namespace(), spec.Child("namespace"))...)
+	errs = append(errs, apivalidation.ValidateImmutableField(names.Prefix(), oldNames.Prefix(), spec.Child("namePrefix"))...)
+
+	for _, s := range pairStorage(old, cluster, spec.Child("components")) {
+		if s.old == nil || s.new == nil || s.old.Size == "" || s.new.Size == "" {
+			continue
+		}
+		errs = append(errs, apivalidation.ValidateImmutableField(s.new.StorageClassName, s.old.StorageClassName,
+			s.path.Child("storageClassName"))...)
+	}
+	return errs
+}
+
+// validateNamePrefix repeats the CRD schema checks of spec.namePrefix, which
+// every generated name and the length checks below depend on.
+func validateNamePrefix(prefix string, path *field.Path) field.ErrorList {
+	if prefix == "" {
+		return nil
+	}
+	if len(prefix) > maxNamePrefixLength {
+		return field.ErrorList{field.TooLong(path, prefix, maxNamePrefixLength)}
+	}
+	if msgs := validation.IsDNS1123Label(prefix); len(msgs) > 0 {
+		return field.ErrorList{field.Invalid(path, prefix, strings.Join(msgs, "; "))}
+	}
+	return nil
+}
+
+func validateImages(cluster *v1alpha1.HonseFarmCluster, path *field.Path) field.ErrorList {
+	comps := cluster.Spec.Components
+	if comps == nil {
+		return nil
+	}
+	images := cluster.Spec.Images
+	if images == nil {
+		images = &v1alpha1.ImagesSpec{}
+	}
+
+	var errs field.ErrorList
+	if comps.Server != nil && images.Server == "" {
+		errs = append(errs, field.Required(path.Child("server"), "must be set when components.server is"))
+	}
+	if comps.AdminPanel != nil && images.AdminPanel == "" {
+		errs = append(errs, field.Required(path.Child("adminPanel"), "must be set when components.adminPanel is"))
+	}
+	if fs := comps.Fileservers; fs != nil {
+		if fs.Main != nil && images.MainFileserver == "" {
+			errs = append(errs, field.Required(path.Child("mainFileserver"), "must be set when components.fileservers.main is"))
+		}
+		if len(fs.Shards) > 0 && images.ShardFileserver == "" {
+			errs = append(errs, field.Required(path.Child("shardFileserver"), "must be set when components.fileservers.shards are"))
+		}
+	}
+	return errs
+}
+
+func validateComponents(cluster *v1alpha1.HonseFarmCluster, path *field.Path) field.ErrorList {
+	comps := cluster.Spec.Components
+	if comps == nil {
+		return nil
+	}
+
+	var errs field.ErrorList
+	if comps.Server != nil {
+		errs = append(errs, validateStorage(comps.Server.Storage, path.Child("server", "storage"), false)...)
+	}
+	if comps.AdminPanel != nil {
+		errs = append(errs, validateStorage(comps.AdminPanel.Storage, path.Child("adminPanel", "storage"), false)...)
+	}
+	if comps.Fileservers == nil {
+		return errs
+	}
+	names := naming.New(cluster)
+	if main := comps.Fileservers.Main; main != nil {
+		mainPath := path.Child("fileservers", "main")
+		if main.WorkloadKind == v1alpha1.WorkloadKindStatefulSet {
+			errs = append(errs, validateStatefulSetName(names.Name(coreinternal.MainFileserverDeploymentName),
+				mainPath.Child("workloadKind"), main.WorkloadKind)...)
+		}
+		errs = append(errs, validateStorage(main.Storage, mainPath.Child("storage"), false)...)
+		errs = append(errs, validateVolume(main.Cache, mainPath.Child("cache"))...)
+		errs = append(errs, validateVolume(main.ColdStorage, mainPath.Child("coldStorage"))...)
+	}
+
+	seen := map[string]bool{}
+	for i, shard := range comps.Fileservers.Shards {
+		shardPath := path.Child("fileservers", "shards").Index(i)
+		namePath := shardPath.Child("name")
+		switch msgs := validation.IsDNS1123Label(shard.Name); {
+		case shard.Name == "":
+			errs = append(errs, field.Required(namePath, ""))
+		case len(msgs) > 0:
+			errs = append(errs, field.Invalid(namePath, shard.Name, strings.Join(msgs, "; ")))
+		case seen[shard.Name]:
+			errs = append(errs, field.Duplicate(namePath, shard.Name))
+		default:
+			// The Service names embed the shard name and the prefix and
+			// have the tighter DNS-1035 limits.
+			svc := names.ShardService(shard.Name).Headless()
+			if msgs := validation.IsDNS1035Label(svc.Name); len(msgs) > 0 {
+				errs = append(errs, field.Invalid(namePath, shard.Name,
+					fmt.Sprintf("gives the invalid Service name %q: %s", svc.Name, strings.Join(msgs, "; "))))
+			}
+			if shard.WorkloadKind == v1alpha1.WorkloadKindStatefulSet {
+				errs = append(errs, validateStatefulSetName(names.Name(coreinternal.ShardDeploymentName(shard.Name)),
+					namePath, shard.Name)...)
+			}
+		}
+		seen[shard.Name] = true
+
+		errs = append(errs, validateStorage(shard.Storage, shardPath.Child("storage"), false)...)
+		errs = append(errs, validateVolume(shard.Cache, shardPath.Child("cache"))...)
+		errs = append(errs, validateVolume(shard.ColdStorage, shardPath.Child("coldStorage"))...)
+	}
+	return errs
+}
+
+// validateStatefulSetName checks the name of a StatefulSet-mode fileserver,
+// reporting a name that is too long against path and value.
+func validateStatefulSetName(name string, path *field.Path, value string) field.ErrorList {
+	if len(name) <= maxStatefulSetNameLength {
+		return nil
+	}
+	return field.ErrorList{field.Invalid(path, value,
+		fmt.Sprintf("gives the StatefulSet name %q, longer than %d characters", name, maxStatefulSetNameLength))}
+}
+
+// validateStorage checks the size of storage. An empty size means no PVC
+// unless required is set.
+func validateStorage(storage *v1alpha1.StorageSpec, path *field.Path, required bool) field.ErrorList {
+	if storage == nil {
+		return nil
+	}
+	if storage.Size == "" {
+		if required {
+			return field.ErrorList{field.Required(path.Child("size"), "")}
+		}
+		return nil
+	}
+	return validateQuantity(storage.Size, path.Child("size"))
+}
+
+// validateVolume checks a fileserver cache or cold-storage volume.
+func validateVolume(volume *v1alpha1.FileserverVolumeSpec, path *field.Path) field.ErrorList {
+	if volume == nil {
+		return nil
+	}
+
+	var errs field.ErrorList
+	set := 0
+	if volume.PVC != nil {
+		set++
+		errs = append(errs, validateStorage(volume.PVC, path.Child("pvc"), true)...)
+	}
+	if volume.EmptyDir != nil {
+		set++
+		if volume.EmptyDir.SizeLimit != "" {
+			errs = append(errs, validateQuantity(volume.EmptyDir.SizeLimit, path.Child("emptyDir", "sizeLimit"))...)
+		}
+		switch corev1.StorageMedium(volume.EmptyDir.Medium) {
+		case corev1.StorageMediumDefault, corev1.StorageMediumMemory:
+		default:
+			errs = append(errs, field.NotSupported(path.Child("emptyDir", "medium"), volume.EmptyDir.Medium,
+				[]string{string(corev1.StorageMediumDefault), string(corev1.StorageMediumMemory)}))
+		}
+	}
+	if volume.Ephemeral != nil {
+		set++
+		errs = append(errs, validateStorage(volume.Ephemeral, path.Child("ephemeral"), true)...)
+	}
+	switch {
+	case set == 0:
+		errs = append(errs, field.Required(path, "one of pvc, emptyDir or ephemeral must be set"))
+	case set > 1:
+		errs = append(errs, field.Forbidden(path, "only one of pvc, emptyDir or ephemeral may be set"))
+	}
+	return errs
+}
+
+func validateQuantity(value string, path *field.Path) field.ErrorList {
+	q, err := resource.ParseQuantity(value)
+	if err != nil {
+		return field.ErrorList{field.Invalid(path, value, err.Error())}
+	}
+	if q.Sign() <= 0 {
+		return field.ErrorList{field.Invalid(path, value, "must be greater than zero")}
+	}
+	return nil
+}
+
+// validateCloudflared checks the tunnel settings and that every ingress
+// rule, or spec.hosts entry it is derived from, points at an enabled
+// component or a known shard.
+func validateCloudflared(cluster *v1alpha1.HonseFarmCluster, path *field.Path) field.ErrorList {
+	if !cloudflared.Enabled(cluster) {
+		return nil
+	}
+	spec := cluster.Spec.Cloudflared
+
+	var errs field.ErrorList
+	if spec.TunnelID == "" && spec.TunnelName == "" {
+		errs = append(errs, field.Required(path.Child("tunnelId"), "tunnelId or tunnelName must be set"))
+	}
+	if spec.CredentialsSecretRef == nil || spec.CredentialsSecretRef.Name == "" {
+		errs = append(errs, field.Required(path.Child("credentialsSecretRef", "name"), ""))
+	}
+	if _, err := cloudflared.ResolveIngress(cluster); err != nil {
+		errs = append(errs, &field.Error{
+			Type:     field.ErrorTypeInvalid,
+			Field:    path.Child("ingress").String(),
+			BadValue: field.OmitValueType{},
+			Detail:   err.Error(),
+		})
+	}
+	return errs
+}
+
+// validateSecretRefs rejects secret references into namespaces other than
+// the cluster's own and spec.namespace.
+func validateSecretRefs(cluster *v1alpha1.HonseFarmCluster) field.ErrorList {
+	names := naming.New(cluster)
+	detail := fmt.Sprintf("must be empty, %q or %q", cluster.Namespace, names.Namespace())
+
+	refs := cfginternal.SecretRefs(cluster)
+	paths := make([]string, 0, len(refs))
+	for path := range refs {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var errs field.ErrorList
+	for _, path := range paths {
+		ref := refs[path]
+		if !names.SecretNamespaceAllowed(ref.Namespace) {
+			errs = append(errs, field.Invalid(field.NewPath(path).Child("namespace"), ref.Namespace, detail))
+		}
+	}
+	if cf := cluster.Spec.Cloudflared; cf != nil && cf.CredentialsSecretRef != nil &&
+		!names.SecretNamespaceAllowed(cf.CredentialsSecretRef.Namespace) {
+		errs = append(errs, field.Invalid(field.NewPath("spec", "cloudflared", "credentialsSecretRef", "namespace"),
+			cf.CredentialsSecretRef.Namespace, detail))
+	}
+	return errs
+}
+
+// storagePair is a StorageSpec before and after an update.
+type storagePair struct {
+	path     *field.Path
+	old, new *v1alpha1.StorageSpec
+}
+
+// pairStorage lists the PVC-backed StorageSpecs of old and cluster by their
+// path in cluster. Shards are matched by name.
+func pairStorage(old, cluster *v1alpha1.HonseFarmCluster, path *field.Path) []storagePair {
+	oldComps, comps := old.Spec.Components, cluster.Spec.Components
+	if oldComps == nil || comps == nil {
+		return nil
+	}
+
+	volumePVC := func(v *v1alpha1.FileserverVolumeSpec) *v1alpha1.StorageSpec {
+		if v == nil {
+			return nil
+		}
+		return v.PVC
+	}
+
+	var pairs []storagePair
+	if oldComps.Server != nil && comps.Server != nil {
+		pairs = append(pairs, storagePair{path.Child("server", "storage"), oldComps.Server.Storage, comps.Server.Storage})
+	}
+	if oldComps.AdminPanel != nil && comps.AdminPanel != nil {
+		pairs = append(pairs, storagePair{path.Child("adminPanel", "storage"), oldComps.AdminPanel.Storage, comps.AdminPanel.Storage})
+	}
+	if oldComps.Fileservers == nil || comps.Fileservers == nil {
+		return pairs
+	}
+	if oldMain, main := oldComps.Fileservers.Main, comps.Fileservers.Main; oldMain != nil && main != nil {
+		mainPath := path.Child("fileservers", "main")
+		pairs = append(pairs,
+			storagePair{mainPath.Child("storage"), oldMain.Storage, main.Storage},
+			storagePair{mainPath.Child("cache", "pvc"), volumePVC(oldMain.Cache), volumePVC(main.Cache)},
+			storagePair{mainPath.Child("coldStorage", "pvc"), volumePVC(oldMain.ColdStorage), volumePVC(main.ColdStorage)},
+		)
+	}
+
+	oldShards := map[string]*v1alpha1.ShardSpec{}
+	for i := range oldComps.Fileservers.Shards {
+		oldShards[oldComps.Fileservers.Shards[i].Name] = &oldComps.Fileservers.Shards[i]
+	}
+	for i := range comps.Fileservers.Shards {
+		shard := &comps.Fileservers.Shards[i]
+		oldShard, ok := oldShards[shard.Name]
+		if !ok {
+			continue
+		}
+		shardPath := path.Child("fileservers", "shards").Index(i)
+		pairs = append(pairs,
+			storagePair{shardPath.Child("storage"), oldShard.Storage, shard.Storage},
+			storagePair{shardPath.Child("cache", "pvc"), volumePVC(oldShard.Cache), volumePVC(shard.Cache)},
+			storagePair{shardPath.Child("coldStorage", "pvc"), volumePVC(oldShard.ColdStorage), volumePVC(shard.ColdStorage)},
+		)
+	}
+	return pairs
+}
@@ -0,0 +1,231 @@
+package webhooks
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	v1alpha1 "honsefarm-operator/api/v1alpha1"
+)
+
+// testCluster returns a valid cluster with a main fileserver and a shard,
+// after mutate has been applied to it.
+func testCluster(mutate func(*v1alpha1.HonseFarmCluster)) *v1alpha1.HonseFarmCluster {
+	cluster := &v1alpha1.HonseFarmCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"},
+		Spec: v1alpha1.HonseFarmClusterSpec{
+			Namespace: "honsefarm",
+			Images: &v1alpha1.ImagesSpec{
+				MainFileserver:  "main:1",
+				ShardFileserver: "shard:1",
+			},
+			Components: &v1alpha1.ComponentsSpec{
+				Fileservers: &v1alpha1.FileserversSpec{
+					Main: &v1alpha1.MainFileserverSpec{
+						Storage: &v1alpha1.StorageSpec{Size: "10Gi"},
+					},
+					Shards: []v1alpha1.ShardSpec{{Name: "eu"}},
+				},
+			},
+		},
+	}
+	if mutate != nil {
+		mutate(cluster)
+	}
+	return cluster
+}
+
+// errorFields lists the sorted "<type> <field>" of errs.
+func errorFields(errs field.ErrorList) []string {
+	out := make([]string, 0, len(errs))
+	for _, err := range errs {
+		out = append(out, string(err.Type)+" "+err.Field)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(*v1alpha1.HonseFarmCluster)
+		want   []string
+	}{
+		{
+			name: "valid",
+		},
+		{
+			name: "namePrefix at the limit",
+			mutate: func(c *v1alpha1.HonseFarmCluster) {
+				c.Spec.NamePrefix = strings.Repeat("a", maxNamePrefixLength)
+			},
+		},
+		{
+			name: "namePrefix too long",
+			mutate: func(c *v1alpha1.HonseFarmCluster) {
+				c.Spec.NamePrefix = strings.Repeat("a", maxNamePrefixLength+1)
+			},
+			want: []string{"FieldValueTooLong spec.namePrefix"},
+		},
+		{
+			name: "namePrefix not a DNS label",
+			mutate: func(c *v1alpha1.HonseFarmCluster) {
+				c.Spec.NamePrefix = "staging-"
+			},
+			want: []string{"FieldValueInvalid spec.namePrefix"},
+		},
+		{
+			name: "missing shard image",
+			mutate: func(c *v1alpha1.HonseFarmCluster) {
+				c.Spec.Images.ShardFileserver = ""
+			},
+			want: []string{"FieldValueRequired spec.images.shardFileserver"},
+		},
+		{
+			name: "invalid storage size",
+			mutate: func(c *v1alpha1.HonseFarmCluster) {
+				c.Spec.Components.Fileservers.Main.Storage.Size = "10 gigs"
+			},
+			want: []string{"FieldValueInvalid spec.components.fileservers.main.storage.size"},
+		},
+		{
+			name: "emptyDir in memory",
+			mutate: func(c *v1alpha1.HonseFarmCluster) {
+				c.Spec.Components.Fileservers.Main.Cache = &v1alpha1.FileserverVolumeSpec{
+					EmptyDir: &v1alpha1.EmptyDirVolumeSpec{SizeLimit: "1Gi", Medium: "Memory"},
+				}
+			},
+		},
+		{
+			name: "emptyDir medium typo",
+			mutate: func(c *v1alpha1.HonseFarmCluster) {
+				c.Spec.Components.Fileservers.Main.Cache = &v1alpha1.FileserverVolumeSpec{
+					EmptyDir: &v1alpha1.EmptyDirVolumeSpec{Medium: "memory"},
+				}
+			},
+			want: []string{"FieldValueNotSupported spec.components.fileservers.main.cache.emptyDir.medium"},
+		},
+		{
+			name: "emptyDir sizeLimit not positive",
+			mutate: func(c *v1alpha1.HonseFarmCluster) {
+				c.Spec.Components.Fileservers.Main.Cache = &v1alpha1.FileserverVolumeSpec{
+					EmptyDir: &v1alpha1.EmptyDirVolumeSpec{SizeLimit: "0"},
+				}
+			},
+			want: []string{"FieldValueInvalid spec.components.fileservers.main.cache.emptyDir.sizeLimit"},
+		},
+		{
+			name: "volume with two sources",
+			mutate: func(c *v1alpha1.HonseFarmCluster) {
+				c.Spec.Components.Fileservers.Shards[0].ColdStorage = &v1alpha1.FileserverVolumeSpec{
+					PVC:      &v1alpha1.StorageSpec{Size: "1Ti"},
+					EmptyDir: &v1alpha1.EmptyDirVolumeSpec{},
+				}
+			},
+			want: []string{"FieldValueForbidden spec.components.fileservers.shards[0].coldStorage"},
+		},
+		{
+			name: "duplicate shard",
+			mutate: func(c *v1alpha1.HonseFarmCluster) {
+				fs := c.Spec.Components.Fileservers
+				fs.Shards = append(fs.Shards, v1alpha1.ShardSpec{Name: "eu"})
+			},
+			want: []string{"FieldValueDuplicate spec.components.fileservers.shards[1].name"},
+		},
+		{
+			name: "long StatefulSet name",
+			mutate: func(c *v1alpha1.HonseFarmCluster) {
+				c.Spec.NamePrefix = strings.Repeat("a", maxNamePrefixLength)
+				c.Spec.Components.Fileservers.Shards[0] = v1alpha1.ShardSpec{
+					Name:         "europe-west-four",
+					WorkloadKind: v1alpha1.WorkloadKindStatefulSet,
+				}
+			},
+			want: []string{"FieldValueInvalid spec.components.fileservers.shards[0].name"},
+		},
+		{
+			name: "long Deployment name",
+			mutate: func(c *v1alpha1.HonseFarmCluster) {
+				c.Spec.NamePrefix = strings.Repeat("a", maxNamePrefixLength)
+				c.Spec.Components.Fileservers.Shards[0] = v1alpha1.ShardSpec{Name: "europe-west-four"}
+			},
+		},
+		{
+			name: "secret reference into spec.namespace",
+			mutate: func(c *v1alpha1.HonseFarmCluster) {
+				c.Spec.Global = &v1alpha1.GlobalConfig{JWT: &v1alpha1.GlobalJWT{
+					SecretRef: &v1alpha1.SecretKeyRef{Name: "jwt", Namespace: "honsefarm", Key: "secret"},
+				}}
+			},
+		},
+		{
+			name: "secret reference into another namespace",
+			mutate: func(c *v1alpha1.HonseFarmCluster) {
+				c.Spec.Global = &v1alpha1.GlobalConfig{JWT: &v1alpha1.GlobalJWT{
+					SecretRef: &v1alpha1.SecretKeyRef{Name: "jwt", Namespace: "kube-system", Key: "secret"},
+				}}
+			},
+			want: []string{"FieldValueInvalid spec.global.jwt.secretRef.namespace"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := errorFields(Validate(testCluster(tt.mutate)))
+			if strings.Join(got, ", ") != strings.Join(tt.want, ", ") {
+				t.Errorf("Validate() errors = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateUpdate(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(*v1alpha1.HonseFarmCluster)
+		want   []string
+	}{
+		{
+			name: "unchanged",
+		},
+		{
+			name: "storage grown",
+			mutate: func(c *v1alpha1.HonseFarmCluster) {
+				c.Spec.Components.Fileservers.Main.Storage.Size = "20Gi"
+			},
+		},
+		{
+			name: "namespace changed",
+			mutate: func(c *v1alpha1.HonseFarmCluster) {
+				c.Spec.Namespace = "elsewhere"
+			},
+			want: []string{"FieldValueInvalid spec.namespace"},
+		},
+		{
+			name: "namePrefix set",
+			mutate: func(c *v1alpha1.HonseFarmCluster) {
+				c.Spec.NamePrefix = "staging"
+			},
+			want: []string{"FieldValueInvalid spec.namePrefix"},
+		},
+		{
+			name: "storage class changed",
+			mutate: func(c *v1alpha1.HonseFarmCluster) {
+				c.Spec.Components.Fileservers.Main.Storage.StorageClassName = "fast"
+			},
+			want: []string{"FieldValueInvalid spec.components.fileservers.main.storage.storageClassName"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := errorFields(ValidateUpdate(testCluster(nil), testCluster(tt.mutate)))
+			if strings.Join(got, ", ") != strings.Join(tt.want, ", ") {
+				t.Errorf("ValidateUpdate() errors = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
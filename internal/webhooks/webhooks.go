@@ -0,0 +1,99 @@
+// Package webhooks serves the admission webhooks of HonseFarmCluster. They
+// fill in the spec defaults and reject specs the controller could only fail
+// on while reconciling, so the mistake is reported to whoever applies the
+// spec.
+package webhooks
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	v1alpha1 "honsefarm-operator/api/v1alpha1"
+)
+
+//+kubebuilder:webhook:path=/mutate-clusters-honse-farm-v1alpha1-honsefarmcluster,mutating=true,failurePolicy=fail,sideEffects=None,groups=clusters.honse.farm,resources=honsefarmclusters,verbs=create;update,versions=v1alpha1,name=mhonsefarmcluster.clusters.honse.farm,admissionReviewVersions=v1
+//+kubebuilder:webhook:path=/validate-clusters-honse-farm-v1alpha1-honsefarmcluster,mutating=false,failurePolicy=fail,sideEffects=None,groups=clusters.honse.farm,resources=honsefarmclusters,verbs=create;update,versions=v1alpha1,name=vhonsefarmcluster.clusters.honse.farm,admissionReviewVersions=v1
+
+// SetupWithManager registers the HonseFarmCluster webhooks with the
+// manager's webhook server.
+func SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&v1alpha1.HonseFarmCluster{}).
+		WithDefaulter(&Defaulter{}).
+		WithValidator(&Validator{}).
+		Complete()
+}
+
+// Defaulter fills in the defaults of HonseFarmClusters on create and update.
+type Defaulter struct{}
+
+var _ admission.CustomDefaulter = &Defaulter{}
+
+// Default implements admission.CustomDefaulter.
+func (d *Defaulter) Default(_ context.Context, obj runtime.Object) error {
+	cluster, ok := obj.(*v1alpha1.HonseFarmCluster)
+	if !ok {
+		return fmt.Errorf("expected a HonseFarmCluster, got %T", obj)
+	}
+	cluster.Default()
+	return nil
+}
+
+// Validator validates HonseFarmClusters on create and update.
+type Validator struct{}
+
+var _ admission.CustomValidator = &Validator{}
+
+// ValidateCreate implements admission.CustomValidator.
+func (v *Validator) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	cluster, ok := obj.(*v1alpha1.HonseFarmCluster)
+	if !ok {
+		return nil, fmt.Errorf("expected a HonseFarmCluster, got %T", obj)
+	}
+	return nil, invalid(cluster, Validate(cluster))
+}
+
+// ValidateUpdate implements admission.CustomValidator. Updates leaving the
+// spec unchanged apart from its defaults are always admitted, so clusters
+// created before a check existed can still get their finalizer added and
+// removed.
+func (v *Validator) ValidateUpdate(_ context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	old, ok := oldObj.(*v1alpha1.HonseFarmCluster)
+	if !ok {
+		return nil, fmt.Errorf("expected a HonseFarmCluster, got %T", oldObj)
+	}
+	cluster, ok := newObj.(*v1alpha1.HonseFarmCluster)
+	if !ok {
+		return nil, fmt.Errorf("expected a HonseFarmCluster, got %T", newObj)
+	}
+	old = old.DeepCopy()
+	old.Default()
+	if equality.Semantic.DeepEqual(old.Spec, cluster.Spec) {
+		return nil, nil
+	}
+
+	errs := ValidateUpdate(old, cluster)
+	errs = append(errs, Validate(cluster)...)
+	return nil, invalid(cluster, errs)
+}
+
+// ValidateDelete implements admission.CustomValidator; deletion is always
+// allowed.
+func (v *Validator) ValidateDelete(context.Context, runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// invalid turns errs into the Invalid API error, nil without errors.
+func invalid(cluster *v1alpha1.HonseFarmCluster, errs field.ErrorList) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(v1alpha1.GroupVersion.WithKind("HonseFarmCluster").GroupKind(), cluster.Name, errs)
+}
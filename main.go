@@ -3,17 +3,21 @@ package main
 import (
     "flag"
     "os"
+    "path/filepath"
+    "strings"
 
     corev1 "k8s.io/api/core/v1"
     "k8s.io/apimachinery/pkg/runtime"
     utilruntime "k8s.io/apimachinery/pkg/util/runtime"
     clientgoscheme "k8s.io/client-go/kubernetes/scheme"
     ctrl "sigs.k8s.io/controller-runtime"
+    "sigs.k8s.io/controller-runtime/pkg/client"
     "sigs.k8s.io/controller-runtime/pkg/healthz"
     "sigs.k8s.io/controller-runtime/pkg/log/zap"
 
     honsefarmiov1alpha1 "honsefarm-operator/api/v1alpha1"
     "honsefarm-operator/controllers"
+    "honsefarm-operator/internal/webhooks"
 )
 
 var (
@@ -31,11 +35,40 @@ func main() {
     var metricsAddr string
     var enableLeaderElection bool
     var probeAddr string
+    var enableWebhooks bool
+    var webhookCertDir string
+    var manageWebhookCerts bool
+    var webhookCertSecret string
+    var webhookServiceName string
+    var webhookConfigurationName string
+    var operatorNamespace string
+
+    // Outside a cluster, e.g. running against a kubeconfig during
+    // development, no Service routes admission requests to the process and
+    // there is no operator namespace to keep the certificates in.
+    inCluster := os.Getenv("KUBERNETES_SERVICE_HOST") != ""
 
     flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
     flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
     flag.BoolVar(&enableLeaderElection, "leader-elect", false,
         "Enable leader election for controller manager.")
+    flag.BoolVar(&enableWebhooks, "enable-webhooks", inCluster,
+        "Serve the HonseFarmCluster admission webhooks on port 9443. Defaults to true in a cluster.")
+    flag.StringVar(&webhookCertDir, "webhook-cert-dir", "",
+        "The directory holding tls.crt and tls.key of the webhook server. Defaults to "+
+            "<temp dir>/k8s-webhook-server/serving-certs.")
+    flag.BoolVar(&manageWebhookCerts, "manage-webhook-certs", inCluster,
+        "Generate and rotate the webhook CA and serving certificate and patch the caBundle of the "+
+            "webhook configurations. Disable to provide the certificate in --webhook-cert-dir yourself. "+
+            "Defaults to true in a cluster.")
+    flag.StringVar(&webhookCertSecret, "webhook-cert-secret", "honsefarm-operator-webhook-certs",
+        "The Secret in --operator-namespace holding the managed webhook certificates.")
+    flag.StringVar(&webhookServiceName, "webhook-service-name", "honsefarm-operator-webhook",
+        "The Service in --operator-namespace fronting the webhook server.")
+    flag.StringVar(&webhookConfigurationName, "webhook-configuration-name", "honsefarm-operator",
+        "The name of the ValidatingWebhookConfiguration and MutatingWebhookConfiguration to patch.")
+    flag.StringVar(&operatorNamespace, "operator-namespace", "",
+        "The namespace the operator runs in. Defaults to the namespace of its service account.")
     opts := zap.Options{
         Development: true,
     }
@@ -44,13 +77,25 @@ func main() {
 
     ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
-    mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+    if webhookCertDir == "" {
+        webhookCertDir = filepath.Join(os.TempDir(), "k8s-webhook-server", "serving-certs")
+    }
+
+    ctx := ctrl.SetupSignalHandler()
+    cfg := ctrl.GetConfigOrDie()
+    mgr, err := ctrl.NewManager(cfg, ctrl.Options{
         Scheme:                 scheme,
         MetricsBindAddress:     metricsAddr,
         Port:                   9443,
+        CertDir:                webhookCertDir,
         HealthProbeBindAddress: probeAddr,
         LeaderElection:         enableLeaderElection,
         LeaderElectionID:       "honsefarm-operator.clusters.honse.farm",
+        // Pods are only listed while a fileserver switches to a
+        // StatefulSet; an informer over every pod would not pay off.
+        Client: client.Options{
+            Cache: &client.CacheOptions{DisableFor: []client.Object{&corev1.Pod{}}},
+        },
     })
     if err != nil {
         setupLog.Error(err, "unable to start manager")
@@ -58,13 +103,54 @@ func main() {
     }
 
     if err = (&controllers.HonseFarmClusterReconciler{
-        Client: mgr.GetClient(),
-        Scheme: mgr.GetScheme(),
+        Client:   mgr.GetClient(),
+        Scheme:   mgr.GetScheme(),
+        Recorder: mgr.GetEventRecorderFor("honsefarm-operator"),
     }).SetupWithManager(mgr); err != nil {
         setupLog.Error(err, "unable to create controller", "controller", "HonseFarmCluster")
         os.Exit(1)
     }
 
+    if enableWebhooks && manageWebhookCerts {
+        if operatorNamespace == "" {
+            operatorNamespace = serviceAccountNamespace()
+        }
+        if operatorNamespace == "" {
+            setupLog.Error(nil, "unable to determine the operator namespace, set --operator-namespace")
+            os.Exit(1)
+        }
+        // The manager's client reads from its cache, which is not started
+        // yet; the webhook server needs the certificate before it starts.
+        certClient, err := client.New(cfg, client.Options{Scheme: scheme})
+        if err != nil {
+            setupLog.Error(err, "unable to create client for webhook certificates")
+            os.Exit(1)
+        }
+        rotator := &webhooks.CertRotator{
+            Client:            certClient,
+            SecretName:        webhookCertSecret,
+            Namespace:         operatorNamespace,
+            ServiceName:       webhookServiceName,
+            ConfigurationName: webhookConfigurationName,
+            CertDir:           webhookCertDir,
+        }
+        if err := rotator.Ensure(ctx); err != nil {
+            setupLog.Error(err, "unable to provision webhook certificates")
+            os.Exit(1)
+        }
+        if err := mgr.Add(rotator); err != nil {
+            setupLog.Error(err, "unable to set up webhook certificate rotation")
+            os.Exit(1)
+        }
+    }
+
+    if enableWebhooks {
+        if err := webhooks.SetupWithManager(mgr); err != nil {
+            setupLog.Error(err, "unable to create webhook", "webhook", "HonseFarmCluster")
+            os.Exit(1)
+        }
+    }
+
     if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
         setupLog.Error(err, "unable to set up health check")
         os.Exit(1)
@@ -75,8 +161,18 @@ func main() {
     }
 
     setupLog.Info("starting manager")
-    if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+    if err := mgr.Start(ctx); err != nil {
         setupLog.Error(err, "problem running manager")
         os.Exit(1)
     }
 }
+
+// serviceAccountNamespace returns the namespace of the pod's service
+// account, empty outside a cluster.
+func serviceAccountNamespace() string {
+    ns, err := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace")
+    if err != nil {
+        return ""
+    }
+    return strings.TrimSpace(string(ns))
+}